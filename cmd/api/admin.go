@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/validator"
+	"github.com/tomasen/realip"
+)
+
+func (app *Application) GetRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.Models.Permissions.GetRoles()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Retrieved all roles", "roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) GetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r, "id")
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	_, err = app.Models.Users.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	roles, err := app.Models.Permissions.GetRolesForUser(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Retrieved roles for user", "roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) SetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	admin := app.contextGetUser(r)
+	id, err := app.readUUIDParam(r, "id")
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Roles != nil, "roles", "must be provided")
+	v.Check(validator.Unique(input.Roles), "roles", "must not contain duplicate values")
+	// Admins can't lock themselves out; another admin has to remove their role.
+	v.Check(id != admin.ID || slices.Contains(input.Roles, models.RoleAdmin), "roles", "you cannot remove your own admin role")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.Models.Users.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.Models.Permissions.SetRolesForUser(id, input.Roles, admin.ID, realip.FromRequest(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("roles", "must only contain existing roles")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.Logger.PrintInfo("user roles changed", map[string]string{
+		"user_id":  id,
+		"actor_id": admin.ID,
+	})
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Updated roles for user", "roles": input.Roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,16 +2,21 @@ package api
 
 import (
 	"sync"
+	"time"
 
 	"github.com/olagookundavid/itoju/internal/jsonlog"
+	"github.com/olagookundavid/itoju/internal/mailer"
 	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/notifier"
 )
 
 type Application struct {
-	Config Config
-	Logger *jsonlog.Logger
-	Models models.Models
-	Wg     sync.WaitGroup
+	Config   Config
+	Logger   *jsonlog.Logger
+	Models   models.Models
+	Mailer   mailer.Mailer
+	Notifier notifier.Notifier
+	Wg       sync.WaitGroup
 }
 
 type Config struct {
@@ -28,6 +33,16 @@ type Config struct {
 		Burst   int
 		Enabled bool
 	}
+	Smtp struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+		Sender   string
+	}
+	Deletion struct {
+		GracePeriod time.Duration
+	}
 	Cors struct {
 		TrustedOrigins []string
 	}
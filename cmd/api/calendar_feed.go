@@ -0,0 +1,274 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/olagookundavid/itoju/internal/ical"
+	"github.com/olagookundavid/itoju/internal/models"
+)
+
+const (
+	// The token sits in the feed URL, which calendar apps keep in plain sight, so it
+	// expires after a year. Before that it is rotated by creating the feed again and
+	// revoked by deleting it.
+	calendarFeedTokenTTL = 365 * 24 * time.Hour
+	// calendarFeedHistory is how far back logged days and medications are included.
+	calendarFeedHistory = 90
+	// calendarFeedPredictions is how many predicted periods are included.
+	calendarFeedPredictions = 6
+	// calendarFeedDoseDays is how many days ahead doses of medication plans are
+	// included.
+	calendarFeedDoseDays = 14
+	// medicationEventLength is how long a medication with a time is shown for.
+	medicationEventLength = 15 * time.Minute
+)
+
+// CreateCalendarFeedHandler creates the secret feed URL of a user, revoking any
+// previous one. The token is only shown here, so a lost URL has to be regenerated.
+func (app *Application) CreateCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	err := app.Models.Tokens.DeleteAllForUser(models.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, err := app.Models.Tokens.New(user.ID, calendarFeedTokenTTL, models.ScopeCalendarFeed)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	scheme := "https"
+	if r.TLS == nil && app.Config.Env == "development" {
+		scheme = "http"
+	}
+	env := envelope{
+		"message":  "Created calendar feed",
+		"feed_url": fmt.Sprintf("%s://%s/v1/calendar/%s.ics", scheme, r.Host, token.Plaintext),
+		"expiry":   token.Expiry}
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) DeleteCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	err := app.Models.Tokens.DeleteAllForUser(models.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Revoked calendar feed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetCalendarFeedHandler serves the calendar of the user whose feed token is in the
+// URL. Calendar apps can't send an Authorization header, so the token is the only
+// credential and unknown tokens are reported as not found.
+func (app *Application) GetCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := app.readStringParam(r, "token")
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	user, err := app.Models.Users.GetForToken(models.ScopeCalendarFeed, strings.TrimSuffix(token, ".ics"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !user.Activated {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	now := time.Now()
+	cal, err := app.buildCalendarFeed(user, now)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="itoju.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	err = ical.Write(w, cal)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{"user_id": user.ID})
+	}
+}
+
+func (app *Application) buildCalendarFeed(user *models.User, now time.Time) (*ical.Calendar, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	since := today.AddDate(0, 0, -calendarFeedHistory)
+
+	days, err := app.Models.UserPeriod.GetCycleDaysSince(user.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := app.Models.Menses.GetMenses(user.ID)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		return nil, err
+	}
+	mode, err := app.Models.UserPeriod.GetTrackingMode(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	predictions, err := app.Models.UserPeriod.GetPredictions(user.ID, settings, mode, calendarFeedPredictions, now)
+	if err != nil {
+		return nil, err
+	}
+	medications, err := app.Models.MedicationMetric.GetUserMedicationMetricsSince(user.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	plans, err := app.Models.MedicationPlans.GetAll(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	until := today.AddDate(0, 0, calendarFeedDoseDays)
+	doses, err := app.Models.MedicationPlans.GetDoses(user.ID, 0, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &ical.Calendar{
+		ProdID: "-//Itoju//Itoju API//EN",
+		Name:   "Itoju",
+		Stamp:  now,
+		Events: []ical.Event{},
+	}
+	cal.Events = append(cal.Events, cycleDayEvents(user.ID, days)...)
+	cal.Events = append(cal.Events, predictionEvents(user.ID, predictions.Predictions)...)
+	cal.Events = append(cal.Events, medicationEvents(user.ID, medications, doses)...)
+	cal.Events = append(cal.Events, doseEvents(user.ID, plans, since, until)...)
+	return cal, nil
+}
+
+// cycleDayEvents turns runs of consecutive period and fertile days into one event
+// each, and every ovulation day into an event of its own.
+func cycleDayEvents(userID string, days []models.CycleDay) []ical.Event {
+	var events []ical.Event
+	addRuns := func(kind, summary string, in func(models.CycleDay) bool) {
+		for i := 0; i < len(days); i++ {
+			if !in(days[i]) {
+				continue
+			}
+			j := i
+			for j+1 < len(days) && in(days[j+1]) && days[j+1].Date.Sub(days[j].Date) == 24*time.Hour {
+				j++
+			}
+			events = append(events, ical.Event{
+				UID:     calendarEventUID(userID, kind, days[i].Date.Format("20060102")),
+				Summary: summary,
+				Start:   days[i].Date,
+				End:     days[j].Date.AddDate(0, 0, 1),
+				AllDay:  true,
+			})
+			i = j
+		}
+	}
+	addRuns("period", "Period", func(day models.CycleDay) bool { return day.IsPeriod })
+	addRuns("fertile", "Fertile window", func(day models.CycleDay) bool { return day.IsFertile })
+	addRuns("ovulation", "Ovulation", func(day models.CycleDay) bool { return day.IsOvulation })
+	return events
+}
+
+func predictionEvents(userID string, predictions []models.PeriodPrediction) []ical.Event {
+	var events []ical.Event
+	for _, prediction := range predictions {
+		key := prediction.StartDate.Format("20060102")
+		events = append(events, ical.Event{
+			UID:     calendarEventUID(userID, "predicted-period", key),
+			Summary: "Expected period",
+			Description: fmt.Sprintf("Likely to start between %s and %s.",
+				prediction.EarliestStart.Format("2 January"), prediction.LatestStart.Format("2 January")),
+			Start:  prediction.StartDate,
+			End:    prediction.EndDate.AddDate(0, 0, 1),
+			AllDay: true,
+		})
+		if prediction.FertileStart != nil && prediction.FertileEnd != nil {
+			events = append(events, ical.Event{
+				UID:     calendarEventUID(userID, "predicted-fertile", key),
+				Summary: "Expected fertile window",
+				Start:   *prediction.FertileStart,
+				End:     prediction.FertileEnd.AddDate(0, 0, 1),
+				AllDay:  true,
+			})
+		}
+		if prediction.OvulationDate != nil {
+			events = append(events, ical.Event{
+				UID:     calendarEventUID(userID, "predicted-ovulation", key),
+				Summary: "Expected ovulation",
+				Start:   *prediction.OvulationDate,
+				AllDay:  true,
+			})
+		}
+	}
+	return events
+}
+
+// medicationEvents gives every medication an event at its time, or for the whole
+// day when the time isn't one the feed understands. Medications logged by taking a
+// dose of a plan are left out, as the dose already has an event.
+func medicationEvents(userID string, medications []*models.MedicationMetric, doses []models.Dose) []ical.Event {
+	fromDose := map[int]bool{}
+	for _, dose := range doses {
+		if dose.MetricID != nil {
+			fromDose[*dose.MetricID] = true
+		}
+	}
+	var events []ical.Event
+	for _, medication := range medications {
+		if fromDose[medication.ID] {
+			continue
+		}
+		event := ical.Event{
+			UID:     calendarEventUID(userID, "medication", fmt.Sprint(medication.ID)),
+			Summary: fmt.Sprintf("%s %g %s", medication.Name, medication.Dosage, medication.Metric),
+			Start:   medication.Date,
+			AllDay:  true,
+		}
+		if medication.Quantity > 0 {
+			event.Description = fmt.Sprintf("Take %g.", medication.Quantity)
+		}
+		if offset, err := models.ParseClock(medication.Time); err == nil {
+			event.Start = time.Date(medication.Date.Year(), medication.Date.Month(), medication.Date.Day(), 0, 0, 0, 0, time.UTC).Add(offset)
+			event.End = event.Start.Add(medicationEventLength)
+			event.AllDay = false
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// doseEvents gives every dose of the plans due between from and to an event.
+func doseEvents(userID string, plans []*models.MedicationPlan, from, to time.Time) []ical.Event {
+	var events []ical.Event
+	for _, plan := range plans {
+		for _, at := range plan.ExpectedDoses(from, to) {
+			events = append(events, ical.Event{
+				UID:     calendarEventUID(userID, fmt.Sprintf("dose-%d", plan.ID), at.Format("20060102T1504")),
+				Summary: fmt.Sprintf("%s %g %s", plan.Name, plan.Dose, plan.Unit),
+				Start:   at,
+				End:     at.Add(medicationEventLength),
+			})
+		}
+	}
+	return events
+}
+
+// calendarEventUID keeps the UID of an event stable between refreshes of the feed,
+// so calendar apps update events instead of duplicating them.
+func calendarEventUID(userID, kind, key string) string {
+	return fmt.Sprintf("%s-%s-%s@itoju.app", kind, key, userID)
+}
@@ -11,6 +11,7 @@ type contextKey string
 
 const userContextKey = contextKey("user")
 const statusContextKey = contextKey("status")
+const tokenContextKey = contextKey("token")
 
 func (app *Application) contextSetUser(r *http.Request, user *models.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -22,6 +23,11 @@ func (app *Application) contextSetTokenStatus(r *http.Request, status bool) *htt
 	return r.WithContext(ctx)
 }
 
+func (app *Application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
 func (app *Application) contextGetUser(r *http.Request) *models.User {
 	user, ok := r.Context().Value(userContextKey).(*models.User)
 	if !ok {
@@ -37,3 +43,11 @@ func (app *Application) contextGetStatus(r *http.Request) bool {
 	}
 	return status
 }
+
+func (app *Application) contextGetToken(r *http.Request) string {
+	token, ok := r.Context().Value(tokenContextKey).(string)
+	if !ok {
+		panic("missing token value in request context")
+	}
+	return token
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"net/http"
+
+	"github.com/olagookundavid/itoju/internal/models"
 )
 
 func (app *Application) GetBowelDaysAnalytics(w http.ResponseWriter, r *http.Request) {
@@ -29,6 +31,61 @@ func (app *Application) GetBowelDaysAnalytics(w http.ResponseWriter, r *http.Req
 
 }
 
+func (app *Application) GetSleepDaysAnalytics(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+	days, err := app.readIntParam(r, "days")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	analytics, err := app.Models.AnalyticsMetric.GetSleepDaysSummaries(user.ID, int(days))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":          "Retrieved All Analytics for user",
+		"analyticsMetrics": analytics}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
+func (app *Application) GetHydrationDaysAnalytics(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+	days, err := app.readIntParam(r, "days")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	weight, err := app.userWeight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	analytics, err := app.Models.AnalyticsMetric.GetHydrationDaysSummaries(user.ID, int(days), models.HydrationGoal(weight))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":          "Retrieved All Analytics for user",
+		"analyticsMetrics": analytics}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
 func (app *Application) GetSymsDaysAnalytics(w http.ResponseWriter, r *http.Request) {
 
 	user := app.contextGetUser(r)
@@ -101,3 +158,28 @@ func EnsureAllDaysPresent(metrics map[int]float64) map[int]float64 {
 	}
 	return metrics
 }
+
+func (app *Application) GetSymsPhaseAnalytics(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+	days, err := app.readIntParam(r, "days")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	analytics, err := app.Models.AnalyticsMetric.GetSymptomPhaseOccurrences(user.ID, int(days))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":          "Retrieved All Analytics for user",
+		"analyticsMetrics": analytics}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
@@ -87,6 +87,10 @@ func (app *Application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	message := "your user account must be activated to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+func (app *Application) accountLockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your account has been temporarily locked after too many failed login attempts, check your email to unlock it"
+	app.errorResponse(w, r, http.StatusLocked, message)
+}
 func (app *Application) NotPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -103,6 +104,19 @@ func (app *Application) readStringParam(r *http.Request, paramName string) (stri
 	return value, nil
 }
 
+var uuidRX = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func (app *Application) readUUIDParam(r *http.Request, paramName string) (string, error) {
+	value, err := app.readStringParam(r, paramName)
+	if err != nil {
+		return "", err
+	}
+	if !validator.Matches(value, uuidRX) {
+		return "", fmt.Errorf("invalid %s parameter", paramName)
+	}
+	return value, nil
+}
+
 func (app *Application) GetDate(r *http.Request) (time.Time, error) {
 	dateString, err := app.readStringParam(r, "date")
 	if err != nil {
@@ -161,6 +175,32 @@ func (app *Application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *Application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+func (app *Application) readDate(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	date, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		v.AddError(key, "must be a date as YYYY-MM-DD")
+		return defaultValue
+	}
+	return date
+}
+
 func (app *Application) Background(fn func()) {
 	app.Wg.Add(1)
 	go func() {
@@ -171,6 +211,5 @@ func (app *Application) Background(fn func()) {
 			}
 		}()
 		fn()
-		app.Wg.Wait()
 	}()
 }
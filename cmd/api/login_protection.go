@@ -0,0 +1,97 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/olagookundavid/itoju/internal/models"
+)
+
+const (
+	// Failed logins older than the window are not counted.
+	loginFailureWindow = 15 * time.Minute
+	// Failures allowed before each further attempt has to wait, doubling every time.
+	accountFreeFailures = 3
+	ipFreeFailures      = 10
+	maxLoginDelay       = 5 * time.Minute
+	// Failures after which the account is locked and an unlock email is sent.
+	accountLockoutFailures = 10
+	accountLockoutDuration = 30 * time.Minute
+)
+
+// loginDelay returns how much longer a client has to wait before its next login
+// attempt is considered, given the failures counted against it.
+func loginDelay(failures, freeFailures int, lastFailure time.Time) time.Duration {
+	if failures < freeFailures {
+		return 0
+	}
+	delay := time.Duration(math.Pow(2, float64(failures-freeFailures))) * time.Second
+	if delay > maxLoginDelay {
+		delay = maxLoginDelay
+	}
+	remaining := time.Until(lastFailure.Add(delay))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+func (app *Application) loginWait(failures *models.LoginFailures) time.Duration {
+	return max(
+		loginDelay(failures.Account, accountFreeFailures, failures.LastAccountFailure),
+		loginDelay(failures.IP, ipFreeFailures, failures.LastIPFailure),
+	)
+}
+
+// recordFailedLogin stores and logs a failed login. When the account crosses the
+// lockout threshold it is locked and the owner is emailed an unlock token.
+func (app *Application) recordFailedLogin(email, ip, reason string, user *models.User, failures *models.LoginFailures) {
+	err := app.Models.LoginAttempts.Insert(email, ip, false)
+	if err != nil {
+		app.Logger.PrintError(err, nil)
+	}
+	accountFailures := failures.Account + 1
+	app.Logger.PrintInfo("failed login attempt", map[string]string{
+		"email":            email,
+		"ip":               ip,
+		"reason":           reason,
+		"account_failures": strconv.Itoa(accountFailures),
+		"ip_failures":      strconv.Itoa(failures.IP + 1),
+	})
+	if user == nil || accountFailures < accountLockoutFailures {
+		return
+	}
+
+	err = app.Models.LoginAttempts.Lock(user.ID, time.Now().Add(accountLockoutDuration))
+	if err != nil {
+		app.Logger.PrintError(err, nil)
+		return
+	}
+	app.Logger.PrintInfo("account locked", map[string]string{
+		"user_id": user.ID,
+		"ip":      ip,
+	})
+	token, err := app.Models.Tokens.New(user.ID, accountLockoutDuration, models.ScopeUnlock)
+	if err != nil {
+		app.Logger.PrintError(err, nil)
+		return
+	}
+	app.Background(func() {
+		data := map[string]any{
+			"unlockToken": token.Plaintext,
+		}
+		err := app.Mailer.Send(user.Email, "account_locked.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *Application) loginThrottledResponse(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	message := "too many failed login attempts, please try again in " + strconv.Itoa(seconds) + " seconds"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
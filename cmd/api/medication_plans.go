@@ -0,0 +1,600 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/notifier"
+	"github.com/olagookundavid/itoju/internal/validator"
+)
+
+const (
+	// adherenceDays is the period adherence is computed over when none is given.
+	adherenceDays = 30
+	// doseListDays is how many days either side of today doses are listed for when
+	// no range is given.
+	doseListDays = 7
+	// maxDoseRangeDays bounds the range doses and adherence may be asked for.
+	maxDoseRangeDays = 366
+)
+
+// scheduledAtLayouts are the accepted layouts of the time of a dose. Any time zone
+// is dropped: doses are due at a clock time, wherever the user is.
+var scheduledAtLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05", time.RFC3339}
+
+func (app *Application) GetMedicationPlans(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	plans, err := app.Models.MedicationPlans.GetAll(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"message": "Retrieved Medication Plans",
+		"plans":   plans}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) CreateMedicationPlan(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Name      string   `json:"name"`
+		Dose      float64  `json:"dose"`
+		Unit      string   `json:"unit"`
+		Frequency string   `json:"frequency"`
+		Times     []string `json:"times"`
+		StartDate string   `json:"start_date"`
+		EndDate   *string  `json:"end_date"`
+		Reminders *bool    `json:"reminders"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	plan := &models.MedicationPlan{
+		UserID:    user.ID,
+		Name:      input.Name,
+		Dose:      input.Dose,
+		Unit:      input.Unit,
+		Frequency: input.Frequency,
+		Times:     input.Times,
+		Reminders: true,
+	}
+	plan.StartDate, err = time.Parse("2006-01-02", input.StartDate)
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("invalid date format"))
+		return
+	}
+	if input.EndDate != nil {
+		endDate, err := time.Parse("2006-01-02", *input.EndDate)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("invalid date format"))
+			return
+		}
+		plan.EndDate = &endDate
+	}
+	if input.Reminders != nil {
+		plan.Reminders = *input.Reminders
+	}
+	v := validator.New()
+	if !app.validateMedicationPlan(w, r, v, plan) {
+		return
+	}
+	err = app.Models.MedicationPlans.Insert(plan)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/user/medication_plans/%d", plan.ID))
+	env := envelope{
+		"message": "Successfully Created Medication Plan",
+		"plan":    plan}
+	err = app.writeJSON(w, http.StatusCreated, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetMedicationPlan returns a plan with its adherence over the last days.
+func (app *Application) GetMedicationPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := app.medicationPlanFromRequest(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	to := now
+	from := models.TruncateToDay(now).AddDate(0, 0, -adherenceDays+1)
+	recorded, err := app.Models.MedicationPlans.GetDoses(plan.UserID, plan.ID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	doses := models.BuildDoses(plan, recorded, from, to, now)
+	env := envelope{
+		"message":   "Retrieved Medication Plan",
+		"plan":      plan,
+		"adherence": models.ComputeAdherence(plan, doses)}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) UpdateMedicationPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := app.medicationPlanFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Name      *string  `json:"name"`
+		Dose      *float64 `json:"dose"`
+		Unit      *string  `json:"unit"`
+		Frequency *string  `json:"frequency"`
+		Times     []string `json:"times"`
+		StartDate *string  `json:"start_date"`
+		EndDate   *string  `json:"end_date"`
+		Reminders *bool    `json:"reminders"`
+		Version   *int     `json:"version"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Version != nil && *input.Version != plan.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	if input.Name != nil {
+		plan.Name = *input.Name
+	}
+	if input.Dose != nil {
+		plan.Dose = *input.Dose
+	}
+	if input.Unit != nil {
+		plan.Unit = *input.Unit
+	}
+	if input.Frequency != nil {
+		plan.Frequency = *input.Frequency
+	}
+	if input.Times != nil {
+		plan.Times = input.Times
+	}
+	if input.StartDate != nil {
+		startDate, err := time.Parse("2006-01-02", *input.StartDate)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("invalid date format"))
+			return
+		}
+		plan.StartDate = startDate
+	}
+	// An empty end date makes the plan open-ended again.
+	if input.EndDate != nil {
+		plan.EndDate = nil
+		if *input.EndDate != "" {
+			endDate, err := time.Parse("2006-01-02", *input.EndDate)
+			if err != nil {
+				app.badRequestResponse(w, r, errors.New("invalid date format"))
+				return
+			}
+			plan.EndDate = &endDate
+		}
+	}
+	if input.Reminders != nil {
+		plan.Reminders = *input.Reminders
+	}
+	v := validator.New()
+	if !app.validateMedicationPlan(w, r, v, plan) {
+		return
+	}
+	err = app.Models.MedicationPlans.Update(plan)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	env := envelope{
+		"message": "Successfully updated Medication Plan",
+		"plan":    plan}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) DeleteMedicationPlan(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	err = app.Models.MedicationPlans.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Medication Plan successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetMedicationPlanDoses lists the expected doses of a plan with their status,
+// together with the adherence over the same range.
+func (app *Application) GetMedicationPlanDoses(w http.ResponseWriter, r *http.Request) {
+	plan, ok := app.medicationPlanFromRequest(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	v := validator.New()
+	from, to := app.readDoseRange(r.URL.Query(), models.TruncateToDay(now).AddDate(0, 0, -doseListDays), models.TruncateToDay(now).AddDate(0, 0, doseListDays), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	recorded, err := app.Models.MedicationPlans.GetDoses(plan.UserID, plan.ID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	doses := models.BuildDoses(plan, recorded, from, to, now)
+	env := envelope{
+		"message":   "Retrieved Medication Doses",
+		"doses":     doses,
+		"adherence": models.ComputeAdherence(plan, doses)}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// RecordMedicationDose marks a dose of a plan as taken or skipped. A taken dose is
+// linked to the medication metric given, or logged as a new one.
+func (app *Application) RecordMedicationDose(w http.ResponseWriter, r *http.Request) {
+	plan, ok := app.medicationPlanFromRequest(w, r)
+	if !ok {
+		return
+	}
+	user := app.contextGetUser(r)
+	var input struct {
+		ScheduledAt string `json:"scheduled_at"`
+		Status      string `json:"status"`
+		MetricID    *int   `json:"metric_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	scheduledAt, err := parseScheduledAt(input.ScheduledAt)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(input.Status, models.DoseTaken, models.DoseSkipped), "status", "must be taken or skipped")
+	v.Check(plan.Expects(scheduledAt), "scheduled_at", "no dose of this plan is due at this time")
+	// Allow for the user being a day ahead of the server.
+	v.Check(!scheduledAt.After(time.Now().AddDate(0, 0, 1)), "scheduled_at", "must not be in the future")
+	v.Check(input.MetricID == nil || input.Status == models.DoseTaken, "metric_id", "can only be given for a taken dose")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	dose := &models.Dose{PlanID: plan.ID, Name: plan.Name, ScheduledAt: scheduledAt, Status: input.Status}
+	var metric *models.MedicationMetric
+	switch {
+	case input.MetricID != nil:
+		_, err := app.Models.MedicationMetric.GetUserMedicationMetric(user.ID, int64(*input.MetricID))
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("metric_id", "no such medication metric")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		dose.MetricID = input.MetricID
+	case input.Status == models.DoseTaken:
+		// Only logged when the dose isn't linked to a medication metric yet.
+		metric = &models.MedicationMetric{
+			Name:     plan.Name,
+			Dosage:   plan.Dose,
+			Metric:   plan.Unit,
+			Quantity: 1,
+			Date:     models.TruncateToDay(scheduledAt),
+			Time:     scheduledAt.Format("15:04"),
+		}
+	}
+	logged, err := app.Models.MedicationPlans.RecordDose(user.ID, dose, metric)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if logged {
+		app.Background(func() {
+			_ = app.Models.UserPoint.InsertPoint(user.ID, "Medication", 2)
+		})
+	}
+	env := envelope{
+		"message": "Successfully recorded Medication Dose",
+		"dose":    dose}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteMedicationDose forgets whether a dose was taken or skipped, so it counts as
+// missed again. The medication metric it was logged as is kept.
+func (app *Application) DeleteMedicationDose(w http.ResponseWriter, r *http.Request) {
+	plan, ok := app.medicationPlanFromRequest(w, r)
+	if !ok {
+		return
+	}
+	scheduledAt, err := parseScheduledAt(r.URL.Query().Get("scheduled_at"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	err = app.Models.MedicationPlans.DeleteDose(plan.UserID, plan.ID, scheduledAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Medication Dose successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetMedicationDoses lists the doses of every plan of the user, by default for
+// today.
+func (app *Application) GetMedicationDoses(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	now := time.Now()
+	v := validator.New()
+	from, to := app.readDoseRange(r.URL.Query(), models.TruncateToDay(now), models.TruncateToDay(now), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	plans, recorded, err := app.medicationPlansWithDoses(user.ID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	doses := []models.Dose{}
+	for _, plan := range plans {
+		doses = append(doses, models.BuildDoses(plan, recorded, from, to, now)...)
+	}
+	sortDoses(doses)
+	env := envelope{
+		"message": "Retrieved Medication Doses",
+		"doses":   doses}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetMedicationAdherence returns the adherence to every plan over a range, by
+// default the last 30 days, and to all of them together.
+func (app *Application) GetMedicationAdherence(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	now := time.Now()
+	v := validator.New()
+	from, to := app.readDoseRange(r.URL.Query(), models.TruncateToDay(now).AddDate(0, 0, -adherenceDays+1), models.TruncateToDay(now), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	plans, recorded, err := app.medicationPlansWithDoses(user.ID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	adherence := []models.Adherence{}
+	overall := models.Adherence{}
+	for _, plan := range plans {
+		planAdherence := models.ComputeAdherence(plan, models.BuildDoses(plan, recorded, from, to, now))
+		if planAdherence.Due == 0 {
+			continue
+		}
+		adherence = append(adherence, planAdherence)
+		overall.Due += planAdherence.Due
+		overall.Taken += planAdherence.Taken
+		overall.Skipped += planAdherence.Skipped
+		overall.Missed += planAdherence.Missed
+	}
+	if overall.Due > 0 {
+		percentage := models.Round(float64(overall.Taken) / float64(overall.Due) * 100)
+		overall.Percentage = &percentage
+	}
+	env := envelope{
+		"message":   "Retrieved Medication Adherence",
+		"from":      from.Format("2006-01-02"),
+		"to":        to.Format("2006-01-02"),
+		"overall":   overall,
+		"adherence": adherence}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// SendMedicationReminders emails every user with reminders on the doses due today.
+// It is run from the daily cron job, and sends each user at most one reminder a day.
+func (app *Application) SendMedicationReminders(now time.Time) error {
+	today := models.TruncateToDay(now)
+	reminders, err := app.Models.MedicationPlans.GetReminders(today)
+	if err != nil {
+		return err
+	}
+	for _, reminder := range reminders {
+		err := app.sendMedicationReminder(reminder, today)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{"user_id": reminder.UserID})
+		}
+	}
+	return nil
+}
+
+// medicationReminderDose is a dose as listed in a reminder email.
+type medicationReminderDose struct {
+	At   time.Time
+	Time string
+	Name string
+	Dose string
+}
+
+func (app *Application) sendMedicationReminder(reminder *models.MedicationReminder, today time.Time) error {
+	endOfDay := today.Add(24*time.Hour - time.Second)
+	var doses []medicationReminderDose
+	for _, plan := range reminder.Plans {
+		for _, at := range plan.ExpectedDoses(today, endOfDay) {
+			doses = append(doses, medicationReminderDose{
+				At:   at,
+				Time: at.Format("15:04"),
+				Name: plan.Name,
+				Dose: fmt.Sprintf("%g %s", plan.Dose, plan.Unit),
+			})
+		}
+	}
+	if len(doses) == 0 {
+		return nil
+	}
+	sort.SliceStable(doses, func(i, j int) bool {
+		return doses[i].At.Before(doses[j].At)
+	})
+
+	first, err := app.Models.Notifications.MarkSent(reminder.UserID, notifier.KindMedicationReminder, today)
+	if err != nil || !first {
+		return err
+	}
+	err = app.Notifier.Notify(notifier.Notification{
+		UserID: reminder.UserID,
+		Email:  reminder.Email,
+		Kind:   notifier.KindMedicationReminder,
+		Data: map[string]any{
+			"firstName": reminder.FirstName,
+			"date":      today.Format("Monday, 2 January"),
+			"doses":     doses,
+		},
+	})
+	if err != nil {
+		// Let the next run try again.
+		unmarkErr := app.Models.Notifications.UnmarkSent(reminder.UserID, notifier.KindMedicationReminder, today)
+		if unmarkErr != nil {
+			app.Logger.PrintError(unmarkErr, map[string]string{"user_id": reminder.UserID})
+		}
+		return err
+	}
+	return nil
+}
+
+// validateMedicationPlan validates a plan and checks its unit against the catalog,
+// sending the error response when the plan is invalid.
+func (app *Application) validateMedicationPlan(w http.ResponseWriter, r *http.Request, v *validator.Validator, plan *models.MedicationPlan) bool {
+	medication, err := app.findMedication(plan.UserID, nil, plan.Name)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	plan.Unit = models.NormalizeMedicationUnit(medication, plan.Unit)
+	models.ValidateMedicationPlan(v, plan)
+	models.ValidateMedicationUnit(v, medication, plan.Unit, "unit")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	return true
+}
+
+func (app *Application) medicationPlanFromRequest(w http.ResponseWriter, r *http.Request) (*models.MedicationPlan, bool) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return nil, false
+	}
+	plan, err := app.Models.MedicationPlans.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return plan, true
+}
+
+func (app *Application) medicationPlansWithDoses(userID string, from, to time.Time) ([]*models.MedicationPlan, []models.Dose, error) {
+	plans, err := app.Models.MedicationPlans.GetAll(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	recorded, err := app.Models.MedicationPlans.GetDoses(userID, 0, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plans, recorded, nil
+}
+
+// readDoseRange reads the from and to dates of the query string. The range runs
+// from the start of from to the end of to.
+func (app *Application) readDoseRange(qs url.Values, defaultFrom, defaultTo time.Time, v *validator.Validator) (time.Time, time.Time) {
+	from := app.readDate(qs, "from", defaultFrom, v)
+	to := app.readDate(qs, "to", defaultTo, v)
+	v.Check(!to.Before(from), "to", "must not be before from")
+	v.Check(to.Sub(from) < maxDoseRangeDays*24*time.Hour, "to", "must be less than a year after from")
+	return from, to.Add(24*time.Hour - time.Second)
+}
+
+func parseScheduledAt(s string) (time.Time, error) {
+	for _, layout := range scheduledAtLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, errors.New("invalid scheduled_at format, expected YYYY-MM-DDTHH:MM")
+}
+
+func sortDoses(doses []models.Dose) {
+	sort.SliceStable(doses, func(i, j int) bool {
+		return doses[i].ScheduledAt.Before(doses[j].ScheduledAt)
+	})
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/validator"
+)
+
+// SearchMedications searches the catalog and the custom medications of the user by
+// name.
+func (app *Application) SearchMedications(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	qs := r.URL.Query()
+	v := validator.New()
+	q := app.readString(qs, "q", "")
+	limit := app.readInt(qs, "limit", 20, v)
+	v.Check(limit >= 1 && limit <= 50, "limit", "must be between 1 and 50")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	medications, err := app.Models.Medications.Search(user.ID, q, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"message":     "Retrieved Medications",
+		"medications": medications}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) CreateCustomMedication(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Name  string   `json:"name"`
+		Forms []string `json:"forms"`
+		Units []string `json:"units"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	medication := &models.Medication{UserID: user.ID, Name: input.Name, Forms: input.Forms, Units: input.Units}
+	for i, unit := range medication.Units {
+		medication.Units[i] = models.NormalizeMedicationUnit(nil, unit)
+	}
+	v := validator.New()
+	if models.ValidateMedication(v, medication); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.Models.Medications.InsertCustom(medication)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordAlreadyExist):
+			v.AddError("name", "you already saved a medication with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/user/medications/%d", medication.ID))
+	env := envelope{
+		"message":    "Successfully saved Medication",
+		"medication": medication}
+	err = app.writeJSON(w, http.StatusCreated, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) DeleteCustomMedication(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	err = app.Models.Medications.DeleteCustom(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Medication successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// findMedication returns the medication with the given id or, without one, the
+// medication called name. An unknown name gives nil: medications missing from the
+// catalog can still be logged, only their units are less strictly checked.
+func (app *Application) findMedication(userID string, id *int64, name string) (*models.Medication, error) {
+	if id != nil {
+		return app.Models.Medications.Get(*id, userID)
+	}
+	medication, err := app.Models.Medications.GetByName(name, userID)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return medication, err
+}
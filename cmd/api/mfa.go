@@ -0,0 +1,325 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/totp"
+	"github.com/olagookundavid/itoju/internal/validator"
+	"github.com/tomasen/realip"
+)
+
+const (
+	totpIssuer        = "Itoju"
+	recoveryCodeCount = 10
+)
+
+// verifyTOTPCode checks a code against the user's secret. A code is only accepted
+// once, so a code seen on the wire cannot be replayed within its time step.
+func (app *Application) verifyTOTPCode(enrollment *models.TOTP, code string) (bool, error) {
+	step, ok := totp.Validate(code, enrollment.Secret, time.Now())
+	if !ok {
+		return false, nil
+	}
+	err := app.Models.TOTP.UseStep(enrollment.UserID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (app *Application) invalidMFACodeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid two-factor authentication code"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *Application) MFALoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	models.ValidateTokenPlaintext(v, input.MFAToken)
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.Models.Users.GetForToken(models.ScopeMFAPending, input.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Wrong codes count towards the same throttling and lockout as wrong passwords.
+	ip := realip.FromRequest(r)
+	failures, err := app.Models.LoginAttempts.GetFailures(user.Email, ip, time.Now().Add(-loginFailureWindow))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if wait := app.loginWait(failures); wait > 0 {
+		app.loginThrottledResponse(w, r, wait)
+		return
+	}
+	_, err = app.Models.LoginAttempts.GetLock(user.ID)
+	if err == nil {
+		app.accountLockedResponse(w, r)
+		return
+	} else if !errors.Is(err, models.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	enrollment, err := app.Models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			// Two-factor authentication was turned off since the password was
+			// checked, so the login has to start over.
+			err = app.Models.Tokens.DeleteAllForUser(models.ScopeMFAPending, user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var valid bool
+	if input.Code != "" {
+		valid, err = app.verifyTOTPCode(enrollment, input.Code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	} else {
+		err = app.Models.TOTP.UseRecoveryCode(user.ID, input.RecoveryCode)
+		switch {
+		case err == nil:
+			valid = true
+			app.Logger.PrintInfo("recovery code used", map[string]string{"user_id": user.ID, "ip": ip})
+		case !errors.Is(err, models.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if !valid {
+		app.recordFailedLogin(user.Email, ip, "wrong mfa code", user, failures)
+		app.invalidMFACodeResponse(w, r)
+		return
+	}
+	err = app.Models.Tokens.DeleteAllForUser(models.ScopeMFAPending, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.completeLogin(w, r, user, ip)
+}
+
+func (app *Application) EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.Models.TOTP.Enroll(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordAlreadyExist):
+			app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	env := envelope{
+		"message":          "Scan the provisioning uri with an authenticator app and confirm with a code",
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer, user.Email, secret)}
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if v.Check(input.Code != "", "code", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	enrollment, err := app.Models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if enrollment.Confirmed {
+		app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+	valid, err := app.verifyTOTPCode(enrollment, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !valid {
+		app.invalidMFACodeResponse(w, r)
+		return
+	}
+	recoveryCodes, err := models.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.Models.TOTP.Confirm(user.ID, recoveryCodes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Logger.PrintInfo("two-factor authentication enabled", map[string]string{"user_id": user.ID})
+	env := envelope{
+		"message":        "Two-factor authentication enabled, store the recovery codes somewhere safe",
+		"recovery_codes": recoveryCodes}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkPasswordAndCode re-authenticates a user before sensitive two-factor changes.
+func (app *Application) checkPasswordAndCode(w http.ResponseWriter, r *http.Request, user *models.User, password, code string) (*models.TOTP, bool) {
+	v := validator.New()
+	models.ValidatePasswordPlaintext(v, password)
+	v.Check(code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+	enrollment, err := app.Models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return nil, false
+	}
+	valid, err := app.verifyTOTPCode(enrollment, code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !valid {
+		app.invalidMFACodeResponse(w, r)
+		return nil, false
+	}
+	return enrollment, true
+}
+
+func (app *Application) DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if _, ok := app.checkPasswordAndCode(w, r, user, input.Password, input.Code); !ok {
+		return
+	}
+	err = app.Models.TOTP.Delete(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Logger.PrintInfo("two-factor authentication disabled", map[string]string{"user_id": user.ID})
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Two-factor authentication disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	enrollment, ok := app.checkPasswordAndCode(w, r, user, input.Password, input.Code)
+	if !ok {
+		return
+	}
+	if !enrollment.Confirmed {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	recoveryCodes, err := models.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.Models.TOTP.ReplaceRecoveryCodes(user.ID, recoveryCodes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"message":        "Recovery codes regenerated, previous codes no longer work",
+		"recovery_codes": recoveryCodes}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
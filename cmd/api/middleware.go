@@ -149,6 +149,7 @@ func (app *Application) Authenticate(next http.Handler) http.Handler {
 
 		r = app.contextSetTokenStatus(r, true)
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 		println("not anon")
 		next.ServeHTTP(w, r)
 	})
@@ -201,3 +202,22 @@ func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
 func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
 	return mw.wrapped
 }
+
+// RequirePermission only lets activated users through who were granted the
+// permission through one of their roles.
+func (app *Application) RequirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		permissions, err := app.Models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.Include(code) {
+			app.NotPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return app.RequireActivatedAndAuthedUser(fn)
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"net/http"
+
+	"github.com/olagookundavid/itoju/internal/models"
 )
 
 func (app *Application) GetMonthBowelAnalytics(w http.ResponseWriter, r *http.Request) {
@@ -29,6 +31,61 @@ func (app *Application) GetMonthBowelAnalytics(w http.ResponseWriter, r *http.Re
 
 }
 
+func (app *Application) GetMonthSleepAnalytics(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+	month, err := app.readIntParam(r, "month")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	analytics, err := app.Models.AnalyticsMetric.GetMonthSleepSummaries(user.ID, int(month))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":          "Retrieved All Analytics for user",
+		"analyticsMetrics": analytics}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
+func (app *Application) GetMonthHydrationAnalytics(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+	month, err := app.readIntParam(r, "month")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	weight, err := app.userWeight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	analytics, err := app.Models.AnalyticsMetric.GetMonthHydrationSummaries(user.ID, int(month), models.HydrationGoal(weight))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":          "Retrieved All Analytics for user",
+		"analyticsMetrics": analytics}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
 func (app *Application) GetSymsMonthAnalytics(w http.ResponseWriter, r *http.Request) {
 
 	user := app.contextGetUser(r)
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/notifier"
+)
+
+const (
+	// periodUpcomingNotice is how many days before the expected start of a period
+	// the reminder is sent.
+	periodUpcomingNotice = 2
+	// periodLateAfter is how many days past the expected start a period that hasn't
+	// been logged counts as late.
+	periodLateAfter = 2
+	// periodLateWindow bounds how late a period may be and still be reported, so users
+	// who stopped logging are not told about a period months overdue.
+	periodLateWindow = 14
+)
+
+// SendPeriodNotifications tells users their period is due soon or late, according
+// to their preferences. Every notification is sent at most once per expected
+// period. It is run from the daily cron job.
+func (app *Application) SendPeriodNotifications(now time.Time) error {
+	recipients, err := app.Models.Notifications.GetRecipients()
+	if err != nil {
+		return err
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for _, recipient := range recipients {
+		err := app.sendPeriodNotification(recipient, today)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{"user_id": recipient.UserID})
+		}
+	}
+	return nil
+}
+
+func (app *Application) sendPeriodNotification(recipient models.NotificationRecipient, today time.Time) error {
+	settings, err := app.Models.Menses.GetMenses(recipient.UserID)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		return err
+	}
+	expected, ok, err := app.Models.UserPeriod.GetExpectedNextPeriod(recipient.UserID, settings)
+	if err != nil || !ok {
+		return err
+	}
+
+	daysUntil := int(expected.Sub(today).Hours() / 24)
+	data := map[string]any{
+		"firstName":    recipient.FirstName,
+		"expectedDate": expected.Format("Monday, 2 January"),
+	}
+	var kind string
+	switch {
+	case daysUntil == periodUpcomingNotice && recipient.Preferences.PeriodUpcoming:
+		kind = notifier.KindPeriodUpcoming
+		data["daysUntil"] = daysUntil
+	case -daysUntil >= periodLateAfter && -daysUntil <= periodLateWindow && recipient.Preferences.PeriodLate:
+		kind = notifier.KindPeriodLate
+		data["daysLate"] = -daysUntil
+	default:
+		return nil
+	}
+
+	first, err := app.Models.Notifications.MarkSent(recipient.UserID, kind, expected)
+	if err != nil || !first {
+		return err
+	}
+	err = app.Notifier.Notify(notifier.Notification{
+		UserID: recipient.UserID,
+		Email:  recipient.Email,
+		Kind:   kind,
+		Data:   data,
+	})
+	if err != nil {
+		// Let the next run try again.
+		unmarkErr := app.Models.Notifications.UnmarkSent(recipient.UserID, kind, expected)
+		if unmarkErr != nil {
+			app.Logger.PrintError(unmarkErr, map[string]string{"user_id": recipient.UserID})
+		}
+		return err
+	}
+	return nil
+}
+
+func (app *Application) GetNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	prefs, err := app.Models.Notifications.GetPreferences(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"message":     "Retrieved notification preferences",
+		"preferences": prefs}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) UpdateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	prefs, err := app.Models.Notifications.GetPreferences(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	var input struct {
+		PeriodUpcoming *bool `json:"period_upcoming"`
+		PeriodLate     *bool `json:"period_late"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.PeriodUpcoming != nil {
+		prefs.PeriodUpcoming = *input.PeriodUpcoming
+	}
+	if input.PeriodLate != nil {
+		prefs.PeriodLate = *input.PeriodLate
+	}
+	err = app.Models.Notifications.UpdatePreferences(prefs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"message":     "Updated notification preferences",
+		"preferences": prefs}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/olagookundavid/itoju/internal/jsonlog"
+	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/notifier"
+)
+
+// testDB opens the database named by TEST_DB_URL, which must have every migration
+// applied. Tests needing it are skipped without one.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_URL")
+	if dsn == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err = db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSendPeriodNotificationsUpcoming(t *testing.T) {
+	db := testDB(t)
+	memory := notifier.NewMemory()
+	app := &Application{
+		Logger:   jsonlog.New(io.Discard, jsonlog.LevelOff),
+		Models:   models.NewModels(db),
+		Notifier: memory,
+	}
+
+	var userID string
+	err := db.QueryRow(` INSERT INTO users (first_name, last_name, date_of_birth, email, password_hash, activated)
+	VALUES ('Ada', 'Test', '1990-01-01', 'period-notifications@example.com', '\x00', true)
+	RETURNING id`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(` DELETE FROM users WHERE id = $1`, userID) })
+
+	// Two cycles 28 days apart, the last one started 26 days ago, so the next period
+	// is expected in 2 days.
+	today := models.TruncateToDay(time.Now())
+	for _, start := range []time.Time{today.AddDate(0, 0, -54), today.AddDate(0, 0, -26)} {
+		_, err := db.Exec(` INSERT INTO menstrual_cycles (user_id, start_date, cycle_length, period_length)
+		VALUES ($1, $2, 28, 5)`, userID, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sent := func() []notifier.Notification {
+		var notifications []notifier.Notification
+		for _, notification := range memory.Notifications() {
+			if notification.UserID == userID {
+				notifications = append(notifications, notification)
+			}
+		}
+		return notifications
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want int
+	}{
+		{"3 days before", today.AddDate(0, 0, -1), 0},
+		{"2 days before", today, 1},
+		{"2 days before again", today, 1},
+		{"1 day before", today.AddDate(0, 0, 1), 1},
+	}
+	for _, tt := range tests {
+		err := app.SendPeriodNotifications(tt.now)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := len(sent()); got != tt.want {
+			t.Fatalf("%s: got %d notifications; want %d", tt.name, got, tt.want)
+		}
+	}
+
+	notification := sent()[0]
+	if notification.Kind != notifier.KindPeriodUpcoming {
+		t.Errorf("got kind %q; want %q", notification.Kind, notifier.KindPeriodUpcoming)
+	}
+	if notification.Data["daysUntil"] != periodUpcomingNotice {
+		t.Errorf("got daysUntil %v; want %d", notification.Data["daysUntil"], periodUpcomingNotice)
+	}
+}
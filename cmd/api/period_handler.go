@@ -1,13 +1,17 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/julienschmidt/httprouter"
 	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/validator"
 )
 
 func (app *Application) GetMenstrualCycle(w http.ResponseWriter, r *http.Request) {
@@ -47,9 +51,19 @@ func (app *Application) GetMenstrualCycle(w http.ResponseWriter, r *http.Request
 	}
 	wg.Wait()
 
+	mode, err := app.Models.UserPeriod.GetTrackingMode(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	env := envelope{
-		"message":     "Retrieved All Period data",
-		"period_days": periodDays}
+		"message":       "Retrieved All Period data",
+		"period_days":   periodDays,
+		"tracking_mode": mode.Mode}
+	if pregnancy := mode.Pregnancy(time.Now()); pregnancy != nil {
+		env["pregnancy"] = pregnancy
+	}
 
 	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
@@ -99,6 +113,33 @@ func (app *Application) AddMenstrualCycle(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	cycle := app.Models.UserPeriod.ReturnMenstrualCycle(
+		user.ID,
+		input.CycleLength,
+		input.PeriodLength,
+		date,
+	)
+	v := validator.New()
+	if models.ValidateMenstrualCycle(v, &cycle); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.Models.UserPeriod.ValidateCycleOverlap(v, &cycle)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	mode, err := app.Models.UserPeriod.GetTrackingMode(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v.Check(mode.Mode != models.ModePregnancy, "start_date", "cycles can't be logged in pregnancy mode")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Start a transaction
 	tx, err := app.Models.Transaction.BeginTx()
 	if err != nil {
@@ -117,19 +158,17 @@ func (app *Application) AddMenstrualCycle(w http.ResponseWriter, r *http.Request
 		}
 	}()
 
-	// Insert the menstrual cycle within the transaction
-	cycle := app.Models.UserPeriod.ReturnMenstrualCycle(
-		user.ID,
-		input.CycleLength,
-		input.PeriodLength,
-		date,
-	)
-
+	err = app.Models.UserPeriod.FitCycleTx(tx, &cycle, mode.Mode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	cycleID, err := app.Models.UserPeriod.InsertMenstrualCycleTx(tx, &cycle)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordAlreadyExist):
-			app.recordAlreadyExistsResponse(w, r)
+			v.AddError("start_date", "a cycle already starts on this date")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -137,24 +176,11 @@ func (app *Application) AddMenstrualCycle(w http.ResponseWriter, r *http.Request
 	}
 
 	// Insert cycle days
-	for i := 0; i < input.PeriodLength; i++ {
-		day := app.Models.UserPeriod.ReturnCycleDay(cycleID, user.ID, true, false, cycle.StartDate.AddDate(0, 0, i))
-		if err := app.Models.UserPeriod.InsertCycleDayTx(tx, &day); err != nil {
-			return
-		}
-	}
-	// Insert regular days
-	for i := input.PeriodLength; i < (input.PeriodLength + 9); i++ {
-		day := app.Models.UserPeriod.ReturnCycleDay(cycleID, user.ID, false, false, cycle.StartDate.AddDate(0, 0, i))
-		if err := app.Models.UserPeriod.InsertCycleDayTx(tx, &day); err != nil {
-			return
-		}
-	}
-
-	// Insert ovulation days
-	for i := (input.PeriodLength + 9); i < (input.CycleLength); i++ {
-		day := app.Models.UserPeriod.ReturnCycleDay(cycleID, user.ID, false, true, cycle.StartDate.AddDate(0, 0, i))
-		if err := app.Models.UserPeriod.InsertCycleDayTx(tx, &day); err != nil {
+	days := app.Models.UserPeriod.GenerateCycleDays(cycleID, user.ID, cycle.StartDate, cycle.CycleLength, cycle.PeriodLength, mode.Mode)
+	for i := range days {
+		err = app.Models.UserPeriod.InsertCycleDayTx(tx, &days[i])
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
 			return
 		}
 	}
@@ -169,6 +195,7 @@ func (app *Application) AddMenstrualCycle(w http.ResponseWriter, r *http.Request
 }
 
 func (app *Application) UpdateMenstrualCycle(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
 	id, err := app.readStringParam(r, "id")
 	if err != nil {
 		app.NotFoundResponse(w, r)
@@ -186,12 +213,14 @@ func (app *Application) UpdateMenstrualCycle(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	var input struct {
-		IsPeriod    *bool     `json:"is_period"`
-		IsOvulation *bool     `json:"is_ovulation"`
-		Flow        *float32  `json:"flow"`
-		Pain        *float32  `json:"pain"`
-		Tags        *[]string `json:"tags"`
-		CMQ         *string   `json:"cmq"`
+		IsPeriod      *bool     `json:"is_period"`
+		IsOvulation   *bool     `json:"is_ovulation"`
+		Flow          *float32  `json:"flow"`
+		Pain          *float32  `json:"pain"`
+		Tags          *[]string `json:"tags"`
+		CMQ           *string   `json:"cmq"`
+		Temperature   *float64  `json:"temperature"`
+		CervicalMucus *string   `json:"cervical_mucus"`
 	}
 	err = app.readJSON(w, r, &input)
 	if err != nil {
@@ -206,6 +235,7 @@ func (app *Application) UpdateMenstrualCycle(w http.ResponseWriter, r *http.Requ
 	}
 	if input.IsOvulation != nil {
 		cycleDay.IsOvulation = *input.IsOvulation
+		cycleDay.OvulationSetByUser = true
 	}
 	if input.IsPeriod != nil {
 		cycleDay.IsPeriod = *input.IsPeriod
@@ -216,6 +246,27 @@ func (app *Application) UpdateMenstrualCycle(w http.ResponseWriter, r *http.Requ
 	if input.Tags != nil {
 		cycleDay.Tags = *input.Tags
 	}
+	if input.Temperature != nil {
+		cycleDay.Temperature = input.Temperature
+	}
+	if input.CervicalMucus != nil {
+		cycleDay.CervicalMucus = *input.CervicalMucus
+	}
+	v := validator.New()
+	if models.ValidateCycleDay(v, cycleDay); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	cycle, err := app.Models.UserPeriod.GetMenstrualCycle(cycleDay.CycleID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
 
 	err = app.Models.UserPeriod.UpdateCycleDay(cycleDay)
 	if err != nil {
@@ -227,9 +278,315 @@ func (app *Application) UpdateMenstrualCycle(w http.ResponseWriter, r *http.Requ
 		}
 		return
 	}
+	// New temperature or mucus observations, or an ovulation the user marked, may
+	// move the fertile window of the whole cycle.
+	if input.Temperature != nil || input.CervicalMucus != nil || input.IsOvulation != nil {
+		mode, err := app.Models.UserPeriod.GetTrackingMode(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.Models.UserPeriod.ConfirmOvulation(cycle, mode.Mode)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		cycleDay, err = app.Models.UserPeriod.GetCycleDay(id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
 	env := envelope{
 		"message":  "Successfully updated Cycle Day",
 		"cycleDay": cycleDay,
+		"cycle":    cycle,
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// UpdatePeriodRoute serves every PUT under /v1/user/period/. PUT /v1/user/period/:id
+// still updates a cycle day for clients from before /v1/user/cycle_day/:id, but
+// httprouter can't hold that wildcard next to /mode and /cycles/:id, so the three
+// share a catch-all and are told apart here.
+func (app *Application) UpdatePeriodRoute(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(httprouter.ParamsFromContext(r.Context()).ByName("path"), "/")
+	segments := strings.Split(path, "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "mode":
+		app.UpdateTrackingMode(w, r)
+	case len(segments) == 2 && segments[0] == "cycles":
+		app.UpdateWholeMenstrualCycle(w, withIDParam(r, segments[1]))
+	case len(segments) == 1 && segments[0] != "":
+		app.UpdateMenstrualCycle(w, withIDParam(r, segments[0]))
+	default:
+		app.NotFoundResponse(w, r)
+	}
+}
+
+// withIDParam() hands id to the handler as if the router had matched it as :id.
+func withIDParam(r *http.Request, id string) *http.Request {
+	params := httprouter.Params{{Key: "id", Value: id}}
+	return r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+}
+
+func (app *Application) GetPeriodPredictions(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	v := validator.New()
+	count := app.readInt(r.URL.Query(), "count", 3, v)
+	v.Check(count >= 1 && count <= 12, "count", "must be between 1 and 12")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	settings, err := app.Models.Menses.GetMenses(user.ID)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	mode, err := app.Models.UserPeriod.GetTrackingMode(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	predictions, err := app.Models.UserPeriod.GetPredictions(user.ID, settings, mode, count, time.Now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":       "Retrieved Period predictions",
+		"stats":         predictions.Stats,
+		"tracking_mode": predictions.Mode,
+		"predictions":   predictions.Predictions}
+	if predictions.Pregnancy != nil {
+		env["pregnancy"] = predictions.Pregnancy
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) UpdateWholeMenstrualCycle(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readUUIDParam(r, "id")
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	cycle, err := app.Models.UserPeriod.GetMenstrualCycle(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		StartDate    *string `json:"start_date"`
+		CycleLength  *int    `json:"cycle_length"`
+		PeriodLength *int    `json:"period_length"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.StartDate != nil {
+		date, err := time.Parse("2006-01-02", *input.StartDate)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("invalid date format"))
+			return
+		}
+		cycle.StartDate = date
+	}
+	if input.CycleLength != nil {
+		cycle.CycleLength = *input.CycleLength
+	}
+	if input.PeriodLength != nil {
+		cycle.PeriodLength = *input.PeriodLength
+	}
+	v := validator.New()
+	if models.ValidateMenstrualCycle(v, cycle); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.Models.UserPeriod.ValidateCycleOverlap(v, cycle)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	mode, err := app.Models.UserPeriod.GetTrackingMode(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tx, err := app.Models.Transaction.BeginTx()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = app.Models.UserPeriod.FitCycleTx(tx, cycle, mode.Mode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.Models.UserPeriod.UpdateMenstrualCycleTx(tx, cycle)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordAlreadyExist):
+			v.AddError("start_date", "a cycle already starts on this date")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	days, err := app.Models.UserPeriod.RegenerateCycleDaysTx(tx, cycle, mode.Mode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":     "Successfully updated User Cycle",
+		"cycle":       cycle,
+		"period_days": days}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) DeleteMenstrualCycle(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readUUIDParam(r, "id")
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	err = app.Models.UserPeriod.DeleteMenstrualCycle(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	env := envelope{"message": "Successfully deleted User Cycle"}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) GetPeriodStats(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	mode, err := app.Models.UserPeriod.GetTrackingMode(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	stats, err := app.Models.UserPeriod.GetCycleStatistics(user.ID, mode.Mode, time.Now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Conditions such as PCOS or endometriosis give the flags their context.
+	conditions, err := app.Models.Conditions.GetUserConditions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":    "Retrieved Period statistics",
+		"stats":      stats,
+		"conditions": conditions}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) GetTrackingMode(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	mode, err := app.Models.UserPeriod.GetTrackingMode(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"message":       "Retrieved tracking mode",
+		"tracking_mode": mode}
+	if pregnancy := mode.Pregnancy(time.Now()); pregnancy != nil {
+		env["pregnancy"] = pregnancy
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) UpdateTrackingMode(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Mode           string  `json:"mode"`
+		PregnancyStart *string `json:"pregnancy_start"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	mode := &models.TrackingMode{UserID: user.ID, Mode: input.Mode}
+	if input.PregnancyStart != nil {
+		date, err := time.Parse("2006-01-02", *input.PregnancyStart)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("invalid date format"))
+			return
+		}
+		mode.PregnancyStart = &date
+	}
+	v := validator.New()
+	if models.ValidateTrackingMode(v, mode, time.Now()); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.Models.UserPeriod.SetTrackingMode(mode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"message":       "Updated tracking mode",
+		"tracking_mode": mode}
+	if pregnancy := mode.Pregnancy(time.Now()); pregnancy != nil {
+		env["pregnancy"] = pregnancy
 	}
 	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
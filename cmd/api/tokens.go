@@ -7,6 +7,14 @@ import (
 
 	"github.com/olagookundavid/itoju/internal/models"
 	"github.com/olagookundavid/itoju/internal/validator"
+	"github.com/tomasen/realip"
+)
+
+const (
+	activationTokenTTL = 3 * 24 * time.Hour
+	accessTokenTTL     = 15 * time.Minute
+	refreshTokenTTL    = 30 * 24 * time.Hour
+	mfaPendingTokenTTL = 5 * time.Minute
 )
 
 func (app *Application) LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -26,16 +34,35 @@ func (app *Application) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	ip := realip.FromRequest(r)
+	failures, err := app.Models.LoginAttempts.GetFailures(input.Email, ip, time.Now().Add(-loginFailureWindow))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if wait := app.loginWait(failures); wait > 0 {
+		app.loginThrottledResponse(w, r, wait)
+		return
+	}
 	user, err := app.Models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
+			app.recordFailedLogin(input.Email, ip, "unknown email", nil, failures)
 			app.invalidCredentialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	_, err = app.Models.LoginAttempts.GetLock(user.ID)
+	if err == nil {
+		app.accountLockedResponse(w, r)
+		return
+	} else if !errors.Is(err, models.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	// Check if the provided password matches the actual password for the user.
 	match, err := user.Password.Matches(input.Password)
 	if err != nil {
@@ -43,10 +70,55 @@ func (app *Application) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !match {
+		app.recordFailedLogin(input.Email, ip, "wrong password", user, failures)
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
-	token, err := app.Models.Tokens.New(user.ID, 24*time.Hour, models.ScopeAuthentication)
+	// Accounts with two-factor authentication only get a short-lived token that has
+	// to be exchanged together with a code at POST /v1/login/mfa.
+	mfaEnabled, err := app.Models.TOTP.IsEnabled(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if mfaEnabled {
+		mfaToken, err := app.Models.Tokens.New(user.ID, mfaPendingTokenTTL, models.ScopeMFAPending)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env := envelope{"message": "Two-factor authentication code required", "mfa_required": true, "mfa_token": mfaToken.Plaintext}
+		err = app.writeJSON(w, http.StatusOK, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.completeLogin(w, r, user, ip)
+}
+
+// completeLogin records a successful login and starts a new session for the user.
+func (app *Application) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, ip string) {
+	err := app.Models.LoginAttempts.Insert(user.Email, ip, true)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Logging in during the grace period of an account deletion cancels it.
+	cancelled, err := app.Models.AccountDeletions.Cancel(user.ID, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if cancelled {
+		app.Logger.PrintInfo("account deletion cancelled", map[string]string{"user_id": user.ID})
+	}
+	sessionID, err := models.NewSessionID()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, refreshToken, err := app.createSessionTokens(r, user.ID, sessionID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -55,7 +127,117 @@ func (app *Application) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		_ = app.Models.UserPoint.InsertPoint(token.UserID, "Login", 5)
 	})
 	// Encode the token to JSON and send it in the response along with a 201 Created // status code.
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Successfully logged in User", "data": token}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Successfully logged in User", "data": token, "refresh": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createSessionTokens issues a short-lived access token and a refresh token for the
+// given session, tagged with the device and ip address of the request.
+func (app *Application) createSessionTokens(r *http.Request, userID, sessionID string) (*models.Token, *models.Token, error) {
+	device := r.UserAgent()
+	if len(device) > 255 {
+		device = device[:255]
+	}
+	ip := realip.FromRequest(r)
+	token, err := app.Models.Tokens.NewForSession(userID, sessionID, accessTokenTTL, models.ScopeAuthentication, device, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken, err := app.Models.Tokens.NewForSession(userID, sessionID, refreshTokenTTL, models.ScopeRefresh, device, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, refreshToken, nil
+}
+
+func (app *Application) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if models.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Refresh tokens are single use: consuming it rotates the session onto a new pair.
+	oldToken, err := app.Models.Tokens.Consume(models.ScopeRefresh, input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Drop the access tokens that were issued from the consumed refresh token.
+	err = app.Models.Tokens.DeleteSession(oldToken.UserID, oldToken.SessionID)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// The session ends once the account is locked or waiting to be deleted.
+	ok, err := app.canRefreshSession(oldToken.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+	token, refreshToken, err := app.createSessionTokens(r, oldToken.UserID, oldToken.SessionID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Successfully refreshed token", "data": token, "refresh": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// canRefreshSession reports whether the user may keep their session: the account
+// must be activated, not locked after failed logins and not waiting to be deleted.
+func (app *Application) canRefreshSession(userID string) (bool, error) {
+	user, err := app.Models.Users.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !user.Activated {
+		return false, nil
+	}
+	_, err = app.Models.LoginAttempts.GetLock(user.ID)
+	if err == nil {
+		return false, nil
+	} else if !errors.Is(err, models.ErrRecordNotFound) {
+		return false, err
+	}
+	pending, err := app.Models.AccountDeletions.IsPending(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return !pending, nil
+}
+
+func (app *Application) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	token := app.contextGetToken(r)
+	err := app.Models.Tokens.DeleteSessionForToken(token)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Successfully logged out User"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -106,19 +288,14 @@ func (app *Application) CreatePasswordResetTokenHandler(w http.ResponseWriter, r
 		data := map[string]any{
 			"passwordResetToken": token.Plaintext,
 		}
-
-		println(data)
-		// Send mail with Otp to reset mail
-		// err = app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
-		// if err != nil {
-		// 	app.logger.PrintError(err, nil)
-		// }
+		err := app.Mailer.Send(user.Email, "token_password_reset.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
 	})
 	// Send a 202 Accepted response and confirmation message to the client.
-	//for now token is sent in body
 	env := envelope{
 		"message": "An email will be sent to you containing password reset instructions",
-		"token":   token.Plaintext,
 	}
 	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
@@ -126,6 +303,112 @@ func (app *Application) CreatePasswordResetTokenHandler(w http.ResponseWriter, r
 	}
 }
 
+func (app *Application) CreateActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if models.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.Models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.Activated {
+		v.AddError("email", "user has already been activated")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Only the most recent activation token should be usable.
+	err = app.Models.Tokens.DeleteAllForUser(models.ScopeActivation, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, err := app.Models.Tokens.New(user.ID, activationTokenTTL, models.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Background(func() {
+		data := map[string]any{
+			"activationToken": token.Plaintext,
+		}
+		err := app.Mailer.Send(user.Email, "token_activation.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+	})
+	env := envelope{
+		"message": "An email will be sent to you containing activation instructions",
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if models.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.Models.Users.GetForToken(models.ScopeUnlock, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unlock token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.Models.LoginAttempts.Unlock(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.Models.LoginAttempts.ClearFailures(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.Models.Tokens.DeleteAllForUser(models.ScopeUnlock, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Logger.PrintInfo("account unlocked", map[string]string{"user_id": user.ID})
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account has been unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 // go func(metricID int) {
 // 	defer wg.Done()
 // 	defer func() {
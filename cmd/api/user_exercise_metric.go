@@ -3,8 +3,10 @@ package api
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/validator"
 )
 
 func (app *Application) GetUserExerciseMetrics(w http.ResponseWriter, r *http.Request) {
@@ -15,6 +17,13 @@ func (app *Application) GetUserExerciseMetrics(w http.ResponseWriter, r *http.Re
 	}
 	user := app.contextGetUser(r)
 	exerciseMetric, err := app.Models.ExerciseMetric.GetUserExerciseMetric(user.ID, date)
+	if err == nil {
+		var weight int
+		weight, err = app.userWeight(user.ID)
+		for _, metric := range exerciseMetric {
+			metric.SetCalories(weight)
+		}
+	}
 
 	if err != nil {
 		switch {
@@ -55,17 +64,27 @@ func (app *Application) CreateExerciseMetric(w http.ResponseWriter, r *http.Requ
 	}
 
 	var input struct {
-		Name string `json:"name"`
+		Name      string `json:"name"`
+		Intensity string `json:"intensity"`
 	}
 	err = app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	if input.Intensity == "" {
+		input.Intensity = models.IntensityModerate
+	}
 	exerciseMetric := &models.ExerciseMetric{
-		UserID: user.ID,
-		Date:   date,
-		Name:   input.Name,
+		UserID:    user.ID,
+		Date:      date,
+		Name:      input.Name,
+		Intensity: input.Intensity,
+	}
+	v := validator.New()
+	if models.ValidateExerciseMetric(v, exerciseMetric); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 	err = app.Models.ExerciseMetric.InsertExerciseMetric(exerciseMetric)
 
@@ -109,19 +128,13 @@ func (app *Application) UpdateExerciseMetric(w http.ResponseWriter, r *http.Requ
 		Ended     *string   `json:"ended"`
 		Tags      *[]string `json:"tags"`
 		NoOfTimes *int      `json:"no_of_times"`
+		Intensity *string   `json:"intensity"`
 	}
 	err = app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	if input.Started != nil {
-		exerciseMetric.Started = *input.Started
-	}
-
-	if input.Ended != nil {
-		exerciseMetric.Ended = *input.Ended
-	}
 
 	if input.NoOfTimes != nil {
 		exerciseMetric.NoOfTimes = *input.NoOfTimes
@@ -131,6 +144,26 @@ func (app *Application) UpdateExerciseMetric(w http.ResponseWriter, r *http.Requ
 		exerciseMetric.Tags = *input.Tags
 	}
 
+	if input.Intensity != nil {
+		exerciseMetric.Intensity = *input.Intensity
+	}
+
+	v := validator.New()
+	if input.Started != nil || input.Ended != nil {
+		started, ended := exerciseMetric.Started, exerciseMetric.Ended
+		if input.Started != nil {
+			started = *input.Started
+		}
+		if input.Ended != nil {
+			ended = *input.Ended
+		}
+		models.ReadExerciseTimes(v, exerciseMetric, started, ended)
+	}
+	if models.ValidateExerciseMetric(v, exerciseMetric); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.Models.ExerciseMetric.UpdateExerciseMetric(exerciseMetric, int(id))
 	if err != nil {
 		switch {
@@ -174,3 +207,53 @@ func (app *Application) DeleteExerciseMetric(w http.ResponseWriter, r *http.Requ
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// GetExerciseWeeklyAnalytics totals the active minutes of the last weeks, this one
+// included, against the 150 minutes a week the WHO recommends.
+func (app *Application) GetExerciseWeeklyAnalytics(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	weeks, err := app.readIntParam(r, "weeks")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if v.Check(weeks >= 1 && weeks <= 52, "weeks", "must be between 1 and 52"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	today := models.TruncateToDay(time.Now().UTC())
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	from := monday.AddDate(0, 0, -7*(int(weeks)-1))
+	exerciseMetrics, err := app.Models.ExerciseMetric.GetUserExerciseMetricsSince(user.ID, from)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	weight, err := app.userWeight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":          "Retrieved All Analytics for user",
+		"analyticsMetrics": models.ExerciseWeeks(exerciseMetrics, from, int(weeks), weight)}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// userWeight returns the weight in kg the user saved, or 0 if they haven't.
+func (app *Application) userWeight(userID string) (int, error) {
+	bodyMeasure, err := app.Models.BodyMeasure.GetBodyMeasure(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return bodyMeasure.WeightKg(), nil
+}
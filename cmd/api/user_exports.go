@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/olagookundavid/itoju/internal/export"
+	"github.com/olagookundavid/itoju/internal/models"
+)
+
+// Finished exports are kept this long before the cron job deletes them.
+const dataExportRetention = 7 * 24 * time.Hour
+
+func (app *Application) CreateDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	dataExport, err := app.Models.DataExports.Insert(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Background(func() {
+		app.runDataExport(user, dataExport.ID)
+	})
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/user/exports/%d", dataExport.ID))
+	env := envelope{
+		"message": "Your export is being prepared",
+		"export":  dataExport}
+	err = app.writeJSON(w, http.StatusAccepted, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GetDataExportHandler sends the archive once the export has completed, and the
+// status of the job until then.
+func (app *Application) GetDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	dataExport, err := app.Models.DataExports.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if dataExport.Status != models.ExportStatusCompleted {
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": "Export is " + dataExport.Status, "export": dataExport}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	filename := fmt.Sprintf("itoju-export-%s.zip", dataExport.CreatedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(dataExport.Archive)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(dataExport.Archive)
+}
+
+func (app *Application) runDataExport(user *models.User, exportID int64) {
+	archive, err := app.buildDataExport(user)
+	if err != nil {
+		app.Logger.PrintError(err, map[string]string{"user_id": user.ID, "export_id": strconv.FormatInt(exportID, 10)})
+		err = app.Models.DataExports.Fail(exportID)
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+		return
+	}
+	err = app.Models.DataExports.Complete(exportID, archive)
+	if err != nil {
+		app.Logger.PrintError(err, nil)
+		return
+	}
+	app.Logger.PrintInfo("data export completed", map[string]string{"user_id": user.ID, "export_id": strconv.FormatInt(exportID, 10)})
+}
+
+func (app *Application) buildDataExport(user *models.User) ([]byte, error) {
+	data, err := app.Models.DataExports.GetUserData(user)
+	if err != nil {
+		return nil, err
+	}
+	files := []export.File{
+		{Name: "symptom_metrics.csv", Records: data.SymptomMetrics},
+		{Name: "sleep_metrics.csv", Records: data.SleepMetrics},
+		{Name: "food_metrics.csv", Records: data.FoodMetrics},
+		{Name: "exercise_metrics.csv", Records: data.ExerciseMetrics},
+		{Name: "urine_metrics.csv", Records: data.UrineMetrics},
+		{Name: "hydration_metrics.csv", Records: data.HydrationMetrics},
+		{Name: "bowel_metrics.csv", Records: data.BowelMetrics},
+		{Name: "medication_metrics.csv", Records: data.MedicationMetrics},
+		{Name: "custom_medications.csv", Records: data.CustomMedications},
+		{Name: "medication_plans.csv", Records: data.MedicationPlans},
+		{Name: "medication_doses.csv", Records: data.MedicationDoses},
+		{Name: "smileys.csv", Records: data.Smileys},
+		{Name: "menstrual_cycles.csv", Records: data.MenstrualCycles},
+		{Name: "cycle_days.csv", Records: data.CycleDays},
+		{Name: "point_records.csv", Records: data.PointRecords},
+	}
+	var buf bytes.Buffer
+	err = export.WriteArchive(&buf, data, files)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DeleteOldDataExports removes exports past their retention. It is run from the
+// daily cron job.
+func (app *Application) DeleteOldDataExports() error {
+	return app.Models.DataExports.DeleteOlderThan(time.Now().Add(-dataExportRetention))
+}
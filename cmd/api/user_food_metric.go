@@ -3,6 +3,7 @@ package api
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/olagookundavid/itoju/internal/models"
 )
@@ -80,6 +81,7 @@ func (app *Application) UpdateUserFoodMetrics(w http.ResponseWriter, r *http.Req
 				app.badRequestResponse(w, r, err)
 				return
 			}
+			app.logGlassNo(user.ID, input.GlassNo)
 			foodMetric := &models.FoodMetric{
 				UserID: user.ID,
 				Date:   date,
@@ -169,12 +171,6 @@ func (app *Application) UpdateUserFoodMetrics(w http.ResponseWriter, r *http.Req
 				foodMetric.SnackTags = []string{}
 			}
 
-			if input.GlassNo != nil {
-				foodMetric.GlassNo = *input.GlassNo
-			} else {
-				foodMetric.GlassNo = 0
-			}
-
 			err = app.Models.FoodMetric.InsertFoodMetric(foodMetric)
 
 			if err != nil {
@@ -220,6 +216,7 @@ func (app *Application) UpdateUserFoodMetrics(w http.ResponseWriter, r *http.Req
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	app.logGlassNo(user.ID, input.GlassNo)
 
 	if input.BreakfastMeal != nil {
 		foodMetric.BreakfastMeal = *input.BreakfastMeal
@@ -274,10 +271,6 @@ func (app *Application) UpdateUserFoodMetrics(w http.ResponseWriter, r *http.Req
 		foodMetric.SnackTags = *input.SnackTags
 	}
 
-	if input.GlassNo != nil {
-		foodMetric.GlassNo = *input.GlassNo
-	}
-
 	err = app.Models.FoodMetric.UpdateFoodMetric(foodMetric)
 	if err != nil {
 		switch {
@@ -296,3 +289,15 @@ func (app *Application) UpdateUserFoodMetrics(w http.ResponseWriter, r *http.Req
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// logGlassNo() logs glasses of water still sent with food by older apps. They are
+// ignored rather than rejected, drinks being counted from hydration metrics only.
+func (app *Application) logGlassNo(userID string, glassNo *int) {
+	if glassNo == nil || *glassNo == 0 {
+		return
+	}
+	app.Logger.PrintInfo("deprecated glass_no ignored", map[string]string{
+		"user_id":  userID,
+		"glass_no": strconv.Itoa(*glassNo),
+	})
+}
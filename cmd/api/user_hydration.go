@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/validator"
+)
+
+// GetUserHydrationMetrics returns the drinks of a day with their total against the
+// daily goal of the user.
+func (app *Application) GetUserHydrationMetrics(w http.ResponseWriter, r *http.Request) {
+	date, err := app.GetDate(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	hydrationMetrics, err := app.Models.HydrationMetric.GetUserHydrationMetrics(user.ID, date)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	weight, err := app.userWeight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":          "Retrieved All Hydration Metrics for user",
+		"hydrationMetrics": hydrationMetrics,
+		"summary":          models.SummarizeHydration(date, hydrationMetrics, models.HydrationGoal(weight))}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) CreateHydrationMetric(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	date, err := app.GetDate(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Time     string `json:"time"`
+		VolumeML int    `json:"volume_ml"`
+		Beverage string `json:"beverage"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Beverage == "" {
+		input.Beverage = models.BeverageWater
+	}
+	hydrationMetric := &models.HydrationMetric{Date: date, VolumeML: input.VolumeML, Beverage: input.Beverage}
+	v := validator.New()
+	models.ReadHydrationTime(v, hydrationMetric, input.Time)
+	if models.ValidateHydrationMetric(v, hydrationMetric); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.HydrationMetric.InsertHydrationMetric(user.ID, hydrationMetric)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/user/hydration_metrics/%d", hydrationMetric.ID))
+	env := envelope{
+		"message":         "Successfully Created User Hydration Metric!",
+		"hydrationMetric": hydrationMetric,
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) UpdateHydrationMetric(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+	hydrationMetric, err := app.Models.HydrationMetric.GetUserHydrationMetric(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Time     *string `json:"time"`
+		VolumeML *int    `json:"volume_ml"`
+		Beverage *string `json:"beverage"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if input.Time != nil {
+		models.ReadHydrationTime(v, hydrationMetric, *input.Time)
+	}
+	if input.VolumeML != nil {
+		hydrationMetric.VolumeML = *input.VolumeML
+	}
+	if input.Beverage != nil {
+		hydrationMetric.Beverage = *input.Beverage
+	}
+	if models.ValidateHydrationMetric(v, hydrationMetric); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.HydrationMetric.UpdateHydrationMetric(user.ID, hydrationMetric)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	env := envelope{
+		"message":         "Successfully updated User Hydration Metric",
+		"hydrationMetric": hydrationMetric,
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) DeleteHydrationMetric(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.HydrationMetric.DeleteHydrationMetric(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Hydration Metric successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,469 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/olagookundavid/itoju/internal/export"
+	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/validator"
+)
+
+const maxImportBytes = 32 << 20
+
+type importRecordResult struct {
+	Type   string `json:"type"`
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// importReport counts the outcome of every record per type and lists the records
+// that could not be imported.
+type importReport struct {
+	DryRun   bool                      `json:"dry_run"`
+	Conflict string                    `json:"conflict"`
+	Summary  map[string]map[string]int `json:"summary"`
+	Errors   []importRecordResult      `json:"errors"`
+}
+
+func (report *importReport) add(recordType string, index int, status string, err error) {
+	if report.Summary[recordType] == nil {
+		report.Summary[recordType] = map[string]int{}
+	}
+	report.Summary[recordType][status]++
+	if err != nil {
+		message := err.Error()
+		if errors.Is(err, models.ErrRecordAlreadyExist) {
+			message = "a conflicting record already exists"
+		}
+		report.Errors = append(report.Errors, importRecordResult{Type: recordType, Index: index, Status: status, Error: message})
+	}
+}
+
+// ImportDataHandler accepts an archive from the export endpoint (application/zip) or
+// its data.json document, and writes it in a single transaction. Every record runs
+// under its own savepoint, so one bad record is reported without aborting the rest.
+// With ?dry_run=true the transaction is rolled back after the report is built.
+// Profile details, points, notification preferences, the tracking mode and the
+// calendar feed are not imported; a feed URL has to be created again.
+func (app *Application) ImportDataHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	v := validator.New()
+	qs := r.URL.Query()
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	conflict := app.readString(qs, "conflict", "skip")
+	v.Check(validator.PermittedValue(conflict, "skip", "overwrite"), "conflict", "must be skip or overwrite")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	data, err := app.readImportData(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tx, err := app.Models.Transaction.BeginTx()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	report := &importReport{DryRun: dryRun, Conflict: conflict, Summary: map[string]map[string]int{}, Errors: []importRecordResult{}}
+	err = app.importUserData(tx, user.ID, data, conflict == "overwrite", report)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !dryRun {
+		err = tx.Commit()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	message := "Data imported"
+	if dryRun {
+		message = "Dry run completed, nothing was imported"
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": message, "report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) readImportData(w http.ResponseWriter, r *http.Request) (*models.UserData, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, errors.New("body must not be empty")
+	}
+
+	document := io.Reader(bytes.NewReader(body))
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/zip") {
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return nil, errors.New("body must be a zip archive")
+		}
+		file, err := zr.Open(export.DocumentName)
+		if err != nil {
+			return nil, fmt.Errorf("archive does not contain %s", export.DocumentName)
+		}
+		defer file.Close()
+		document = file
+	}
+
+	var data models.UserData
+	err = json.NewDecoder(document).Decode(&data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid export document: %w", err)
+	}
+	return &data, nil
+}
+
+// importRecord runs fn under a savepoint. The returned error is only set when the
+// transaction itself can no longer be used.
+func (app *Application) importRecord(tx *sql.Tx, report *importReport, recordType string, index int, fn func() (string, error)) error {
+	const savepoint = "import_record"
+	err := app.Models.Transaction.Savepoint(tx, savepoint)
+	if err != nil {
+		return err
+	}
+	status, err := fn()
+	if err != nil {
+		report.add(recordType, index, models.ImportFailed, err)
+		return app.Models.Transaction.RollbackToSavepoint(tx, savepoint)
+	}
+	report.add(recordType, index, status, nil)
+	return app.Models.Transaction.ReleaseSavepoint(tx, savepoint)
+}
+
+func (app *Application) importUserData(tx *sql.Tx, userID string, data *models.UserData, overwrite bool, report *importReport) error {
+	imports := app.Models.DataImports
+	missingDate := errors.New("date must be provided")
+
+	for i, metric := range data.TrackedMetrics {
+		err := app.importRecord(tx, report, "tracked_metrics", i, func() (string, error) {
+			return imports.ImportUserMetricTx(tx, userID, metric.Id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, condition := range data.Conditions {
+		err := app.importRecord(tx, report, "conditions", i, func() (string, error) {
+			return imports.ImportUserConditionTx(tx, userID, condition.Id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, symptom := range data.Symptoms {
+		err := app.importRecord(tx, report, "symptoms", i, func() (string, error) {
+			return imports.ImportUserSymptomTx(tx, userID, symptom.Id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, medication := range data.CustomMedications {
+		err := app.importRecord(tx, report, "custom_medications", i, func() (string, error) {
+			for j, unit := range medication.Units {
+				medication.Units[j] = models.NormalizeMedicationUnit(nil, unit)
+			}
+			v := validator.New()
+			if models.ValidateMedication(v, medication); !v.Valid() {
+				return "", errors.New("custom medication is not valid")
+			}
+			return imports.ImportCustomMedicationTx(tx, userID, medication, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if data.Menses != nil {
+		err := app.importRecord(tx, report, "menses", 0, func() (string, error) {
+			return imports.ImportMensesTx(tx, userID, data.Menses, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if data.BodyMeasure != nil {
+		err := app.importRecord(tx, report, "body_measure", 0, func() (string, error) {
+			return imports.ImportBodyMeasureTx(tx, userID, data.BodyMeasure, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, symsMetric := range data.SymptomMetrics {
+		err := app.importRecord(tx, report, "symptom_metrics", i, func() (string, error) {
+			if symsMetric.Date.IsZero() {
+				return "", missingDate
+			}
+			return imports.ImportSymsMetricTx(tx, userID, symsMetric, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, sleepMetric := range data.SleepMetrics {
+		err := app.importRecord(tx, report, "sleep_metrics", i, func() (string, error) {
+			if sleepMetric.Date.IsZero() {
+				return "", missingDate
+			}
+			// Exports made before sleep had timestamps only carry the times of day.
+			if (sleepMetric.SleptAt == nil || sleepMetric.WokeAt == nil) && (sleepMetric.TimeSlept != "" || sleepMetric.TimeWokeUp != "") {
+				models.ReadSleepTimes(validator.New(), sleepMetric, sleepMetric.TimeSlept, sleepMetric.TimeWokeUp)
+			}
+			v := validator.New()
+			if models.ValidateSleepMetric(v, sleepMetric); !v.Valid() {
+				return "", errors.New("time_slept and time_woke_up must be a valid sleep")
+			}
+			return imports.ImportSleepMetricTx(tx, userID, sleepMetric, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, foodMetric := range data.FoodMetrics {
+		err := app.importRecord(tx, report, "food_metrics", i, func() (string, error) {
+			if foodMetric.Date.IsZero() {
+				return "", missingDate
+			}
+			return imports.ImportFoodMetricTx(tx, userID, foodMetric, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, exerciseMetric := range data.ExerciseMetrics {
+		err := app.importRecord(tx, report, "exercise_metrics", i, func() (string, error) {
+			if exerciseMetric.Date.IsZero() {
+				return "", missingDate
+			}
+			// Exports made before exercise had timestamps and an intensity only carry
+			// the times of day.
+			if exerciseMetric.StartedAt == nil {
+				models.ReadExerciseTimes(validator.New(), exerciseMetric, exerciseMetric.Started, exerciseMetric.Ended)
+			}
+			if exerciseMetric.Intensity == "" {
+				exerciseMetric.Intensity = models.IntensityModerate
+			}
+			v := validator.New()
+			if models.ValidateExerciseMetric(v, exerciseMetric); !v.Valid() {
+				return "", errors.New("exercise metric is not valid")
+			}
+			return imports.ImportExerciseMetricTx(tx, userID, exerciseMetric, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, urineMetric := range data.UrineMetrics {
+		err := app.importRecord(tx, report, "urine_metrics", i, func() (string, error) {
+			if urineMetric.Date.IsZero() {
+				return "", missingDate
+			}
+			return imports.ImportUrineMetricTx(tx, userID, urineMetric, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, hydrationMetric := range data.HydrationMetrics {
+		err := app.importRecord(tx, report, "hydration_metrics", i, func() (string, error) {
+			if hydrationMetric.Date.IsZero() {
+				return "", missingDate
+			}
+			v := validator.New()
+			if models.ValidateHydrationMetric(v, hydrationMetric); !v.Valid() {
+				return "", errors.New("hydration metric is not valid")
+			}
+			return imports.ImportHydrationMetricTx(tx, userID, hydrationMetric, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// Exports from before hydration metrics only have the glasses of water logged
+	// with food, which are copied the way the migration adding hydration did.
+	if len(data.HydrationMetrics) == 0 {
+		for i, foodMetric := range data.FoodMetrics {
+			hydrationMetric := foodMetric.GlassesAsHydration()
+			if hydrationMetric == nil || foodMetric.Date.IsZero() {
+				continue
+			}
+			err := app.importRecord(tx, report, "food_metric_glasses", i, func() (string, error) {
+				return imports.ImportHydrationMetricTx(tx, userID, hydrationMetric, overwrite)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for i, bowelMetric := range data.BowelMetrics {
+		err := app.importRecord(tx, report, "bowel_metrics", i, func() (string, error) {
+			if bowelMetric.Date.IsZero() {
+				return "", missingDate
+			}
+			return imports.ImportBowelMetricTx(tx, userID, bowelMetric, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, medicationMetric := range data.MedicationMetrics {
+		err := app.importRecord(tx, report, "medication_metrics", i, func() (string, error) {
+			if medicationMetric.Date.IsZero() {
+				return "", missingDate
+			}
+			medicationMetric.Metric = models.NormalizeMedicationUnit(nil, medicationMetric.Metric)
+			v := validator.New()
+			models.ValidateDosage(v, medicationMetric.Dosage, "dosage")
+			models.ValidateMedicationUnit(v, nil, medicationMetric.Metric, "metric")
+			if !v.Valid() {
+				return "", errors.New("medication metric is not valid")
+			}
+			return imports.ImportMedicationMetricTx(tx, userID, medicationMetric, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// Plans and doses reference each other, and doses their medication metric, by
+	// the ids they had in the exporting database.
+	planIDs := map[int64]int64{}
+	for i, plan := range data.MedicationPlans {
+		exportedID := plan.ID
+		err := app.importRecord(tx, report, "medication_plans", i, func() (string, error) {
+			plan.Unit = models.NormalizeMedicationUnit(nil, plan.Unit)
+			v := validator.New()
+			models.ValidateMedicationUnit(v, nil, plan.Unit, "unit")
+			if models.ValidateMedicationPlan(v, plan); !v.Valid() {
+				return "", errors.New("medication plan is not valid")
+			}
+			planID, status, err := imports.ImportMedicationPlanTx(tx, userID, plan, overwrite)
+			if err != nil {
+				return status, err
+			}
+			planIDs[exportedID] = planID
+			return status, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	medicationMetrics := map[int]*models.MedicationMetric{}
+	for _, medicationMetric := range data.MedicationMetrics {
+		medicationMetrics[medicationMetric.ID] = medicationMetric
+	}
+	for i := range data.MedicationDoses {
+		dose := &data.MedicationDoses[i]
+		err := app.importRecord(tx, report, "medication_doses", i, func() (string, error) {
+			planID, ok := planIDs[dose.PlanID]
+			if !ok {
+				return "", errors.New("plan_id does not match an imported medication plan")
+			}
+			if dose.ScheduledAt.IsZero() {
+				return "", errors.New("scheduled_at must be provided")
+			}
+			if !validator.PermittedValue(dose.Status, models.DoseTaken, models.DoseSkipped) {
+				return "", errors.New("status must be taken or skipped")
+			}
+			var metric *models.MedicationMetric
+			if dose.MetricID != nil {
+				metric = medicationMetrics[*dose.MetricID]
+			}
+			dose.PlanID = planID
+			return imports.ImportMedicationDoseTx(tx, userID, dose, metric, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, smiley := range data.Smileys {
+		err := app.importRecord(tx, report, "smileys", i, func() (string, error) {
+			if smiley.Time.IsZero() {
+				return "", errors.New("time must be provided")
+			}
+			return imports.ImportSmileyTx(tx, userID, smiley, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Cycle days reference their cycle by the id it had in the exporting database.
+	mode, err := app.Models.UserPeriod.GetTrackingMode(userID)
+	if err != nil {
+		return err
+	}
+	cycleIDs := map[string]string{}
+	for i := range data.MenstrualCycles {
+		cycle := &data.MenstrualCycles[i]
+		exportedID := cycle.ID
+		err := app.importRecord(tx, report, "menstrual_cycles", i, func() (string, error) {
+			v := validator.New()
+			if models.ValidateMenstrualCycle(v, cycle); !v.Valid() {
+				return "", errors.New("menstrual cycle is not valid")
+			}
+			cycle.UserID = userID
+			err := app.Models.UserPeriod.ValidateCycleOverlapTx(tx, v, cycle)
+			if err != nil {
+				return "", err
+			}
+			if !v.Valid() {
+				return "", errors.New("start_date " + v.Errors["start_date"])
+			}
+			err = app.Models.UserPeriod.FitCycleTx(tx, cycle, mode.Mode)
+			if err != nil {
+				return "", err
+			}
+			cycleID, status, err := imports.ImportMenstrualCycleTx(tx, userID, cycle, overwrite)
+			if err != nil {
+				return status, err
+			}
+			cycleIDs[exportedID] = cycleID
+			return status, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i := range data.CycleDays {
+		day := &data.CycleDays[i]
+		err := app.importRecord(tx, report, "cycle_days", i, func() (string, error) {
+			cycleID, ok := cycleIDs[day.CycleID]
+			if !ok {
+				return "", errors.New("cycle_id does not match an imported menstrual cycle")
+			}
+			if day.Date.IsZero() {
+				return "", missingDate
+			}
+			day.CycleID = cycleID
+			return imports.ImportCycleDayTx(tx, userID, day, overwrite)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
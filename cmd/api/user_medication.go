@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/validator"
 )
 
 func (app *Application) GetUserMedicationMetrics(w http.ResponseWriter, r *http.Request) {
@@ -79,6 +80,26 @@ func (app *Application) UpdateMedicationMetric(w http.ResponseWriter, r *http.Re
 	if input.Metric != nil {
 		medicationMetric.Metric = *input.Metric
 	}
+	v := validator.New()
+	if input.Name != nil || input.Metric != nil {
+		medication, err := app.findMedication(app.contextGetUser(r).ID, nil, medicationMetric.Name)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		medicationMetric.Metric = models.NormalizeMedicationUnit(medication, medicationMetric.Metric)
+		models.ValidateMedicationUnit(v, medication, medicationMetric.Metric, "metric")
+	}
+	if input.Dosage != nil {
+		models.ValidateDosage(v, medicationMetric.Dosage, "dosage")
+	}
+	if input.Quantity != nil {
+		models.ValidateQuantity(v, medicationMetric.Quantity, "quantity")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
 	err = app.Models.MedicationMetric.UpdateMedicationMetric(medicationMetric)
 	if err != nil {
@@ -109,11 +130,12 @@ func (app *Application) CreateMedicationMetric(w http.ResponseWriter, r *http.Re
 	}
 
 	var input struct {
-		Time     string  `json:"time"`
-		Name     string  `json:"name"`
-		Metric   string  `json:"metric"`
-		Dosage   float64 `json:"dosage"`
-		Quantity float64 `json:"quantity"`
+		Time         string  `json:"time"`
+		Name         string  `json:"name"`
+		MedicationID *int64  `json:"medication_id"`
+		Metric       string  `json:"metric"`
+		Dosage       float64 `json:"dosage"`
+		Quantity     float64 `json:"quantity"`
 	}
 	err = app.readJSON(w, r, &input)
 	if err != nil {
@@ -123,6 +145,31 @@ func (app *Application) CreateMedicationMetric(w http.ResponseWriter, r *http.Re
 	medicationMetric := &models.MedicationMetric{
 		Time: input.Time, Dosage: input.Dosage, Quantity: input.Quantity, Metric: input.Metric, Date: date, Name: input.Name}
 
+	v := validator.New()
+	medication, err := app.findMedication(user.ID, input.MedicationID, input.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("medication_id", "no such medication")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if medication != nil {
+		medicationMetric.Name = medication.Name
+	}
+	medicationMetric.Metric = models.NormalizeMedicationUnit(medication, medicationMetric.Metric)
+	v.Check(medicationMetric.Name != "", "name", "must be provided")
+	models.ValidateDosage(v, medicationMetric.Dosage, "dosage")
+	models.ValidateMedicationUnit(v, medication, medicationMetric.Metric, "metric")
+	models.ValidateQuantity(v, medicationMetric.Quantity, "quantity")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.Models.MedicationMetric.InsertMedicationMetric(user.ID, medicationMetric)
 
 	if err != nil {
@@ -3,10 +3,14 @@ package api
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/validator"
 )
 
+const emailChangeTokenTTL = 24 * time.Hour
+
 func (app *Application) GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 	env := envelope{
@@ -51,3 +55,198 @@ func (app *Application) UpdateUserProfilePicHandler(w http.ResponseWriter, r *ht
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *Application) UpdateUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FirstName *string    `json:"first_name"`
+		LastName  *string    `json:"last_name"`
+		Dob       *time.Time `json:"dob"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	if input.FirstName != nil {
+		user.FirstName = *input.FirstName
+	}
+	if input.LastName != nil {
+		user.LastName = *input.LastName
+	}
+	if input.Dob != nil {
+		user.Dob = *input.Dob
+	}
+	v := validator.New()
+	if models.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	env := envelope{
+		"message": "your profile has been updated",
+		"user":    user}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// CreateEmailChangeHandler starts an email change. The address on the account only
+// changes once the token sent to the new address is confirmed.
+func (app *Application) CreateEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	v := validator.New()
+	models.ValidateEmail(v, input.Email)
+	models.ValidatePasswordPlaintext(v, input.Password)
+	v.Check(input.Email != user.Email, "email", "must be different from the current email address")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+	_, err = app.Models.Users.GetByEmail(input.Email)
+	if err == nil {
+		v.AddError("email", "a user with this email address already exists")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	} else if !errors.Is(err, models.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.Models.EmailChanges.Insert(user.ID, input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Only the token for the latest requested address should be usable.
+	err = app.Models.Tokens.DeleteAllForUser(models.ScopeEmailChange, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, err := app.Models.Tokens.New(user.ID, emailChangeTokenTTL, models.ScopeEmailChange)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Background(func() {
+		data := map[string]any{
+			"firstName":        user.FirstName,
+			"emailChangeToken": token.Plaintext,
+		}
+		err := app.Mailer.Send(input.Email, "token_email_change.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+		data = map[string]any{
+			"firstName": user.FirstName,
+			"newEmail":  input.Email,
+		}
+		err = app.Mailer.Send(user.Email, "email_change_notice.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+	})
+	env := envelope{"message": "An email will be sent to the new address containing confirmation instructions"}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if models.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.Models.Users.GetForToken(models.ScopeEmailChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	newEmail, err := app.Models.EmailChanges.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user.Email = newEmail
+	err = app.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.Models.EmailChanges.Delete(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.Models.Tokens.DeleteAllForUser(models.ScopeEmailChange, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Logger.PrintInfo("email address changed", map[string]string{"user_id": user.ID})
+	env := envelope{
+		"message": "your email address has been changed",
+		"user":    user}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/validator"
 )
 
 func (app *Application) GetUserSleepMetrics(w http.ResponseWriter, r *http.Request) {
@@ -119,15 +120,24 @@ func (app *Application) UpdateSleepMetric(w http.ResponseWriter, r *http.Request
 	if input.Severity != nil {
 		sleepMetric.Severity = *input.Severity
 	}
-	if input.TimeSlept != nil {
-		sleepMetric.TimeSlept = *input.TimeSlept
-	}
-	if input.TimeWokeUp != nil {
-		sleepMetric.TimeWokeUp = *input.TimeWokeUp
-	}
 	if input.Tags != nil {
 		sleepMetric.Tags = *input.Tags
 	}
+	v := validator.New()
+	if input.TimeSlept != nil || input.TimeWokeUp != nil {
+		timeSlept, timeWokeUp := sleepMetric.TimeSlept, sleepMetric.TimeWokeUp
+		if input.TimeSlept != nil {
+			timeSlept = *input.TimeSlept
+		}
+		if input.TimeWokeUp != nil {
+			timeWokeUp = *input.TimeWokeUp
+		}
+		models.ReadSleepTimes(v, sleepMetric, timeSlept, timeWokeUp)
+	}
+	if models.ValidateSleepMetric(v, sleepMetric); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
 	err = app.Models.SleepMetric.UpdateSleepMetric(sleepMetric)
 	if err != nil {
@@ -170,7 +180,15 @@ func (app *Application) CreateSleepMetric(w http.ResponseWriter, r *http.Request
 		return
 	}
 	sleepMetric := &models.SleepMetric{
-		IsNight: input.IsNight, TimeSlept: input.TimeSlept, TimeWokeUp: input.TimeWokeUp, Tags: input.Tags, Date: date, Severity: input.Severity}
+		IsNight: input.IsNight, Tags: input.Tags, Date: date, Severity: input.Severity}
+	v := validator.New()
+	if input.TimeSlept != "" || input.TimeWokeUp != "" {
+		models.ReadSleepTimes(v, sleepMetric, input.TimeSlept, input.TimeWokeUp)
+	}
+	if models.ValidateSleepMetric(v, sleepMetric); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
 	err = app.Models.SleepMetric.InsertSleepMetric(user.ID, sleepMetric)
 
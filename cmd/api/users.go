@@ -7,6 +7,7 @@ import (
 
 	"github.com/olagookundavid/itoju/internal/models"
 	"github.com/olagookundavid/itoju/internal/validator"
+	"github.com/tomasen/realip"
 )
 
 func (app *Application) RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -27,7 +28,7 @@ func (app *Application) RegisterUserHandler(w http.ResponseWriter, r *http.Reque
 		LastName:  input.LastName,
 		Dob:       input.Dob,
 		Email:     input.Email,
-		Activated: true}
+		Activated: false}
 	err = user.Password.Set(input.Password)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -49,20 +50,21 @@ func (app *Application) RegisterUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	// _, err = app.Models.Tokens.New(user.ID, 3*24*time.Hour, models.ScopeActivation)
-	// if err != nil {
-	// 	app.serverErrorResponse(w, r, err)
-	// 	return
-	// }
-	// app.background(func() {
-	// 	data := map[string]any{
-	// 		"activationToken": token.Plaintext,
-	// 		"userID":          user.ID}
-	// 	err = app.mailer.Send(user.Email, "user_welcome.html", data)
-	// 	if err != nil {
-	// 		app.logger.PrintError(err, nil)
-	// 	}
-	// })
+	token, err := app.Models.Tokens.New(user.ID, activationTokenTTL, models.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Background(func() {
+		data := map[string]any{
+			"firstName":       user.FirstName,
+			"activationToken": token.Plaintext,
+		}
+		err := app.Mailer.Send(user.Email, "user_welcome.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+	})
 
 	app.Background(func() {
 		_ = app.Models.UserPoint.InsertPoint(user.ID, "Register", 10)
@@ -75,6 +77,57 @@ func (app *Application) RegisterUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+func (app *Application) ActivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if models.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// GetForToken only matches tokens that have not expired yet, so an expired
+	// activation token is reported the same way as an unknown one.
+	user, err := app.Models.Users.GetForToken(models.ScopeActivation, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user.Activated = true
+	err = app.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.Models.Tokens.DeleteAllForUser(models.ScopeActivation, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"message": "Successfully activated User",
+		"user":    user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *Application) UpdateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse and validate the user's new password and password reset token.
 	var input struct {
@@ -192,3 +245,113 @@ func (app *Application) ChangeUserPasswordHandler(w http.ResponseWriter, r *http
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *Application) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if models.ValidatePasswordPlaintext(v, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+	// Users with two-factor authentication have to confirm with a code as well.
+	enrollment, err := app.Models.TOTP.Get(user.ID)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err == nil && enrollment.Confirmed {
+		valid, err := app.verifyTOTPCode(enrollment, input.Code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !valid {
+			app.invalidMFACodeResponse(w, r)
+			return
+		}
+	}
+	ip := realip.FromRequest(r)
+	if app.Config.Deletion.GracePeriod <= 0 {
+		err = app.Models.AccountDeletions.DeleteAccount(user.ID, ip)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.Logger.PrintInfo("account deleted", map[string]string{"user_id": user.ID})
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account and all of its data have been deleted"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	deleteAfter := time.Now().Add(app.Config.Deletion.GracePeriod)
+	err = app.Models.AccountDeletions.Schedule(user.ID, deleteAfter, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Log the user out everywhere; logging in again cancels the deletion.
+	err = app.Models.Tokens.DeleteAllScopesForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Logger.PrintInfo("account deletion requested", map[string]string{
+		"user_id":      user.ID,
+		"delete_after": deleteAfter.Format(time.RFC3339),
+	})
+	app.Background(func() {
+		data := map[string]any{
+			"firstName":   user.FirstName,
+			"deleteAfter": deleteAfter.Format("2 January 2006"),
+		}
+		err := app.Mailer.Send(user.Email, "account_deletion.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+	})
+	env := envelope{
+		"message":      "your account will be deleted, log in again before then to cancel",
+		"delete_after": deleteAfter}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// FinalizeAccountDeletions deletes the accounts whose grace period has passed. It is
+// run from the daily cron job.
+func (app *Application) FinalizeAccountDeletions() error {
+	userIDs, err := app.Models.AccountDeletions.GetDue(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		err := app.Models.AccountDeletions.DeleteAccount(userID, "")
+		if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+			app.Logger.PrintError(err, map[string]string{"user_id": userID})
+			continue
+		}
+		app.Logger.PrintInfo("account deleted", map[string]string{"user_id": userID})
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"net/http"
+
+	"github.com/olagookundavid/itoju/internal/models"
 )
 
 func (app *Application) GetBowelYearAnalytics(w http.ResponseWriter, r *http.Request) {
@@ -29,6 +31,61 @@ func (app *Application) GetBowelYearAnalytics(w http.ResponseWriter, r *http.Req
 
 }
 
+func (app *Application) GetSleepYearAnalytics(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+	year, err := app.readIntParam(r, "year")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	analytics, err := app.Models.AnalyticsMetric.GetYearSleepSummaries(user.ID, int(year))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":          "Retrieved All Analytics for user",
+		"analyticsMetrics": analytics}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
+func (app *Application) GetHydrationYearAnalytics(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+	year, err := app.readIntParam(r, "year")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	weight, err := app.userWeight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	analytics, err := app.Models.AnalyticsMetric.GetYearHydrationSummaries(user.ID, int(year), models.HydrationGoal(weight))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":          "Retrieved All Analytics for user",
+		"analyticsMetrics": analytics}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
 func (app *Application) GetSymsYearAnalytics(w http.ResponseWriter, r *http.Request) {
 
 	user := app.contextGetUser(r)
@@ -16,6 +16,7 @@ import (
 	"github.com/olagookundavid/itoju/cmd/api"
 	"github.com/olagookundavid/itoju/internal/jsonlog"
 	"github.com/olagookundavid/itoju/internal/models"
+	"github.com/olagookundavid/itoju/internal/notifier"
 	"github.com/olagookundavid/itoju/internal/server"
 )
 
@@ -40,7 +41,9 @@ func main() {
 		Config: *cfg,
 		Logger: logger,
 		Models: models.NewModels(db),
+		Mailer: mailerSetup(*cfg),
 	}
+	app.Notifier = notifier.NewEmail(app.Mailer)
 
 	intializeBackGroundTask(app)
 
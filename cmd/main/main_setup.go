@@ -13,6 +13,7 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/olagookundavid/itoju/cmd/api"
+	"github.com/olagookundavid/itoju/internal/mailer"
 	"github.com/olagookundavid/itoju/internal/vcs"
 	"github.com/robfig/cron/v3"
 )
@@ -101,31 +102,51 @@ func cronJob(app *api.Application) {
 	//	}
 	c := cron.New()
 
-	_, err := c.AddFunc("@daily", func() {
-		app.Logger.PrintInfo("Deleting Tokens from tokens table", nil)
-		err := app.Models.Tokens.DeleteAllExpiredTokens()
-		if err != nil {
-			app.Logger.PrintError(err, map[string]string{"error": "An error occured with deleting tokens from Tokens Table"})
-			return
-		}
-	})
-	_, err = c.AddFunc("@daily", func() {
-		app.Logger.PrintInfo("Deleting Over 1 week Points", nil)
-		err := app.Models.UserPoint.DeletePointRecordMoreThanWeek()
+	jobs := []struct {
+		spec string
+		name string
+		fn   func() error
+	}{
+		{"@daily", "Deleting Tokens from tokens table", app.Models.Tokens.DeleteAllExpiredTokens},
+		{"@daily", "Deleting Over 1 week Points", app.Models.UserPoint.DeletePointRecordMoreThanWeek},
+		{"@daily", "Deleting old login attempts", func() error {
+			return app.Models.LoginAttempts.DeleteOlderThan(time.Now().Add(-24 * time.Hour))
+		}},
+		{"@daily", "Deleting accounts past their deletion grace period", app.FinalizeAccountDeletions},
+		{"@daily", "Deleting old data exports", app.DeleteOldDataExports},
+		{"@daily", "Sending period notifications", func() error { return app.SendPeriodNotifications(time.Now()) }},
+		{"@daily", "Sending medication reminders", func() error { return app.SendMedicationReminders(time.Now()) }},
+	}
+	for _, job := range jobs {
+		job := job
+		_, err := c.AddFunc(job.spec, func() {
+			app.Logger.PrintInfo(job.name, nil)
+			err := job.fn()
+			if err != nil {
+				app.Logger.PrintError(err, map[string]string{"job": job.name, "error": "An error occured with the cron job"})
+			}
+		})
+		// A job that can't be scheduled doesn't stop the others.
 		if err != nil {
-			app.Logger.PrintError(err, map[string]string{"error": "An error occured with deleting from points records table"})
-			return
+			app.Logger.PrintError(err, map[string]string{"job": job.name, "error": "An error occured scheduling the cron job"})
 		}
-	})
-
-	if err != nil {
-		app.Logger.PrintError(err, map[string]string{"error": "An error occured with the cron job"})
-		return
 	}
 
 	c.Start()
 }
 
+func mailerSetup(cfg api.Config) mailer.Mailer {
+	// Without an SMTP host emails are dropped, which is only acceptable in local
+	// development.
+	if cfg.Smtp.Host == "" {
+		if cfg.Env != "development" {
+			log.Fatal("SMTP_HOST env variable missing")
+		}
+		return mailer.NewNop()
+	}
+	return mailer.NewSMTP(cfg.Smtp.Host, cfg.Smtp.Port, cfg.Smtp.Username, cfg.Smtp.Password, cfg.Smtp.Sender)
+}
+
 func flagSetup(dbUrl string) *api.Config {
 
 	var cfg api.Config
@@ -142,6 +163,14 @@ func flagSetup(dbUrl string) *api.Config {
 	flag.Float64Var(&cfg.Limiter.Rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.Limiter.Burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.Limiter.Enabled, "limiter-enabled", true, "Enable rate limiter")
+	//smtp
+	flag.StringVar(&cfg.Smtp.Host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP host")
+	flag.IntVar(&cfg.Smtp.Port, "smtp-port", 587, "SMTP port")
+	flag.StringVar(&cfg.Smtp.Username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.Smtp.Password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.Smtp.Sender, "smtp-sender", "Itoju <no-reply@itoju.app>", "SMTP sender")
+	//account deletion
+	flag.DurationVar(&cfg.Deletion.GracePeriod, "deletion-grace-period", 14*24*time.Hour, "Time before a deleted account is erased (0 erases immediately)")
 
 	return &cfg
 }
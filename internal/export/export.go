@@ -0,0 +1,132 @@
+// Package export writes a user's data as a zip archive holding one JSON document
+// with everything and a CSV file per record type, for use in spreadsheets.
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DocumentName is the name of the JSON document inside an archive.
+const DocumentName = "data.json"
+
+// File is a CSV file in the archive. Records must be a slice of structs or of
+// pointers to structs; the columns are taken from the fields' json tags.
+type File struct {
+	Name    string
+	Records any
+}
+
+// WriteArchive writes document as JSON followed by each of the CSV files.
+func WriteArchive(w io.Writer, document any, files []File) error {
+	zw := zip.NewWriter(w)
+
+	fw, err := zw.Create(DocumentName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(document)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		fw, err := zw.Create(file.Name)
+		if err != nil {
+			return err
+		}
+		err = WriteCSV(fw, file.Records)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// WriteCSV writes records with a header row. Fields tagged json:"-" are left out,
+// times are written as RFC 3339 and string slices are joined with semicolons.
+func WriteCSV(w io.Writer, records any) error {
+	rv := reflect.ValueOf(records)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("records must be a slice, got %s", rv.Kind())
+	}
+	elemType := rv.Type().Elem()
+	if elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("records must be a slice of structs, got %s", elemType.Kind())
+	}
+
+	var header []string
+	var fields []int
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+	row := make([]string, len(fields))
+	for i := 0; i < rv.Len(); i++ {
+		record := reflect.Indirect(rv.Index(i))
+		if !record.IsValid() {
+			continue
+		}
+		for j, field := range fields {
+			row[j] = formatValue(record.Field(field))
+		}
+		err := cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	case *time.Time:
+		if value == nil {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	case []string:
+		return strings.Join(value, ";")
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,115 @@
+// Package ical writes calendars in the iCalendar format of RFC 5545, so events can
+// be subscribed to from phone and desktop calendar apps.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+	// maxLineLength is the longest a content line may be, in octets, before it has
+	// to be folded.
+	maxLineLength = 75
+)
+
+// Event is a VEVENT. All-day events use only the dates of Start and End; other
+// events are written in floating time, so they happen at the same clock time in
+// whatever time zone the calendar is viewed. End is exclusive and defaults to the
+// day after Start for all-day events.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+}
+
+// Calendar is a VCALENDAR. Stamp is when the calendar was generated and is given
+// to every event as its DTSTAMP.
+type Calendar struct {
+	ProdID string
+	Name   string
+	Stamp  time.Time
+	Events []Event
+}
+
+// Write writes the calendar with CRLF line endings and long lines folded.
+func Write(w io.Writer, cal *Calendar) error {
+	bw := bufio.NewWriter(w)
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:"+escapeText(cal.ProdID))
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "METHOD:PUBLISH")
+	if cal.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(cal.Name))
+	}
+	stamp := cal.Stamp.UTC().Format(dateTimeLayout) + "Z"
+	for _, event := range cal.Events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+escapeText(event.UID))
+		writeLine(bw, "DTSTAMP:"+stamp)
+		if event.AllDay {
+			end := event.End
+			if !end.After(event.Start) {
+				end = event.Start.AddDate(0, 0, 1)
+			}
+			writeLine(bw, "DTSTART;VALUE=DATE:"+event.Start.Format(dateLayout))
+			writeLine(bw, "DTEND;VALUE=DATE:"+end.Format(dateLayout))
+		} else {
+			writeLine(bw, "DTSTART:"+event.Start.Format(dateTimeLayout))
+			if event.End.After(event.Start) {
+				writeLine(bw, "DTEND:"+event.End.Format(dateTimeLayout))
+			}
+		}
+		writeLine(bw, "SUMMARY:"+escapeText(event.Summary))
+		if event.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escapeText(event.Description))
+		}
+		writeLine(bw, "TRANSP:TRANSPARENT")
+		writeLine(bw, "END:VEVENT")
+	}
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+// writeLine folds line into pieces of at most maxLineLength octets, never splitting
+// a UTF-8 character, with every continuation starting with a space. Errors are kept
+// by the bufio.Writer and returned from Flush.
+func writeLine(bw *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		bw.WriteString(line[:cut])
+		bw.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the length of a continuation line.
+		limit = maxLineLength - 1
+	}
+	bw.WriteString(line)
+	bw.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// escapeText escapes a TEXT value as section 3.3.11 of RFC 5545 requires.
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
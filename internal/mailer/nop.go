@@ -0,0 +1,15 @@
+package mailer
+
+// NopMailer renders every message, so broken templates still surface, and then
+// drops it. It is used in development when no SMTP host is configured; messages
+// carry tokens, so they are never written anywhere.
+type NopMailer struct{}
+
+func NewNop() NopMailer {
+	return NopMailer{}
+}
+
+func (m NopMailer) Send(recipient, templateFile string, data any) error {
+	_, err := render(recipient, templateFile, data)
+	return err
+}
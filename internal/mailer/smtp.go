@@ -0,0 +1,106 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+type SMTPMailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+func NewSMTP(host string, port int, username, password, sender string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		addr:   host + ":" + strconv.Itoa(port),
+		auth:   auth,
+		sender: sender,
+	}
+}
+
+func (m *SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+	body, err := m.compose(msg)
+	if err != nil {
+		return err
+	}
+	// Try sending the email up to three times before aborting and returning the final
+	// error. We sleep for 500 milliseconds between each attempt.
+	for i := 1; i <= 3; i++ {
+		err = smtp.SendMail(m.addr, m.auth, m.sender, []string{recipient}, body)
+		if err == nil {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return err
+}
+
+// compose builds a multipart/alternative message with the plain text body first,
+// so clients that can render HTML pick the last part.
+func (m *SMTPMailer) compose(msg *Message) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writer := multipart.NewWriter(buf)
+
+	messageID := make([]byte, 12)
+	_, err := rand.Read(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := new(bytes.Buffer)
+	fmt.Fprintf(headers, "From: %s\r\n", m.sender)
+	fmt.Fprintf(headers, "To: %s\r\n", msg.Recipient)
+	fmt.Fprintf(headers, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(headers, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(headers, "Message-ID: <%s@itoju>\r\n", hex.EncodeToString(messageID))
+	fmt.Fprintf(headers, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(headers, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", msg.PlainBody},
+		{"text/html; charset=UTF-8", msg.HTMLBody},
+	}
+	for _, p := range parts {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(part)
+		_, err = qp.Write([]byte(p.body))
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return append(headers.Bytes(), buf.Bytes()...), nil
+}
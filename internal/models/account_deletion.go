@@ -0,0 +1,135 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type AccountDeletionModel struct {
+	DB *sql.DB
+}
+
+// Schedule() marks the account for deletion once deleteAfter has passed. Asking
+// again keeps the original schedule.
+func (m AccountDeletionModel) Schedule(userID string, deleteAfter time.Time, ip string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO account_deletions (user_id, delete_after)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO NOTHING`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = tx.ExecContext(ctx, query, userID, deleteAfter)
+	if err != nil {
+		return err
+	}
+	err = insertAuditLog(ctx, tx, userID, AuditAccountDeletionRequested, ip)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Cancel() removes a pending deletion and reports whether there was one.
+func (m AccountDeletionModel) Cancel(userID, ip string) (bool, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := tx.ExecContext(ctx, ` DELETE FROM account_deletions WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+	err = insertAuditLog(ctx, tx, userID, AuditAccountDeletionCancelled, ip)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// IsPending() reports whether the account is waiting to be deleted.
+func (m AccountDeletionModel) IsPending(userID string) (bool, error) {
+	query := ` SELECT EXISTS (SELECT 1 FROM account_deletions WHERE user_id = $1)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var pending bool
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&pending)
+	return pending, err
+}
+
+// GetDue() returns the users whose grace period has passed.
+func (m AccountDeletionModel) GetDue(now time.Time) ([]string, error) {
+	query := ` SELECT user_id FROM account_deletions WHERE delete_after <= $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	userIDs := []string{}
+	for rows.Next() {
+		var userID string
+		err := rows.Scan(&userID)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+// DeleteAccount() erases the user and everything they own. Every user-owned table
+// references users ON DELETE CASCADE, so deleting the user row removes the metrics,
+// cycles, cycle days, points, tokens and settings with it. Login attempts are keyed
+// by email rather than user and are removed explicitly.
+func (m AccountDeletionModel) DeleteAccount(userID, ip string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = tx.ExecContext(ctx, ` DELETE FROM login_attempts WHERE email = (SELECT email FROM users WHERE id = $1)`, userID)
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, ` DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	err = insertAuditLog(ctx, tx, userID, AuditAccountDeleted, ip)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
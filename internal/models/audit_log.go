@@ -0,0 +1,36 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	AuditAccountDeletionRequested = "account_deletion_requested"
+	AuditAccountDeletionCancelled = "account_deletion_cancelled"
+	AuditAccountDeleted           = "account_deleted"
+	AuditRolesChanged             = "roles_changed"
+)
+
+type AuditLogModel struct {
+	DB *sql.DB
+}
+
+func (m AuditLogModel) Insert(userID, action, ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return insertAuditLog(ctx, m.DB, userID, action, ip)
+}
+
+func insertAuditLog(ctx context.Context, db execer, userID, action, ip string) error {
+	return insertActorAuditLog(ctx, db, userID, action, ip, "")
+}
+
+// insertActorAuditLog() records an action another user, such as an admin, took on
+// the account. An empty actorID means the user acted themselves.
+func insertActorAuditLog(ctx context.Context, db execer, userID, action, ip, actorID string) error {
+	query := ` INSERT INTO audit_log (user_id, action, ip, actor_id) VALUES ($1, $2, $3, NULLIF($4, '')::UUID)`
+	_, err := db.ExecContext(ctx, query, userID, action, ip, actorID)
+	return err
+}
@@ -9,6 +9,14 @@ import (
 	"github.com/olagookundavid/itoju/internal/validator"
 )
 
+// maxBodyWeight bounds the weight, in kg, a user may save; minBodyWeight is the
+// smallest weight calorie and hydration estimates are made from.
+const (
+	minBodyWeight = 20
+	maxBodyWeight = 400
+)
+
+// BodyMeasure holds the height of a user in cm and their weight in kg.
 type BodyMeasure struct {
 	Id     string `json:"-"`
 	Height int    `json:"height"`
@@ -22,6 +30,17 @@ type BodyMeasureModel struct {
 func ValidateBodyMeasure(v *validator.Validator, bodyMeasure *BodyMeasure) {
 	v.Check(bodyMeasure.Height >= 0, "Height", "cannot be less or equals zero")
 	v.Check(bodyMeasure.Weight >= 0, "Weight", "cannot be less or equals zero")
+	v.Check(bodyMeasure.Weight <= maxBodyWeight, "Weight", "must be in kg and not more than 400")
+}
+
+// WeightKg() returns the weight to base estimates on, or 0 when none was saved or
+// the saved one can't be a weight in kg, e.g. one entered in pounds before the
+// unit was checked.
+func (b *BodyMeasure) WeightKg() int {
+	if b.Weight < minBodyWeight || b.Weight > maxBodyWeight {
+		return 0
+	}
+	return b.Weight
 }
 
 func (m BodyMeasureModel) GetBodyMeasure(id string) (*BodyMeasure, error) {
@@ -50,6 +69,14 @@ func (m BodyMeasureModel) GetBodyMeasure(id string) (*BodyMeasure, error) {
 }
 
 func (m BodyMeasureModel) InsertBodyMeasure(bodyMeasure *BodyMeasure) error {
+	return insertBodyMeasure(m.DB, bodyMeasure)
+}
+
+func (m BodyMeasureModel) InsertBodyMeasureTx(tx *sql.Tx, bodyMeasure *BodyMeasure) error {
+	return insertBodyMeasure(tx, bodyMeasure)
+}
+
+func insertBodyMeasure(db execer, bodyMeasure *BodyMeasure) error {
 	query := `
 	INSERT INTO bodymeasure (user_id, height, weight)
 	VALUES ($1, $2, $3) `
@@ -57,7 +84,7 @@ func (m BodyMeasureModel) InsertBodyMeasure(bodyMeasure *BodyMeasure) error {
 	args := []any{bodyMeasure.Id, bodyMeasure.Height, bodyMeasure.Weight}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := db.ExecContext(ctx, query, args...)
 	return err
 }
 
@@ -74,7 +74,14 @@ func (m BowelMetricModel) GetUserBowelMetric(userId string, id int64) (*BowelMet
 }
 
 func (m BowelMetricModel) InsertBowelMetric(userID string, bowelMetric *BowelMetric) error {
+	return insertBowelMetric(m.DB, userID, bowelMetric)
+}
+
+func (m BowelMetricModel) InsertBowelMetricTx(tx *sql.Tx, userID string, bowelMetric *BowelMetric) error {
+	return insertBowelMetric(tx, userID, bowelMetric)
+}
 
+func insertBowelMetric(db execer, userID string, bowelMetric *BowelMetric) error {
 	query := `
 	INSERT INTO user_bowel_metric (user_id, time, pain, type, date, tags)
 	VALUES ($1, $2, $3, $4, $5, $6) `
@@ -82,11 +89,8 @@ func (m BowelMetricModel) InsertBowelMetric(userID string, bowelMetric *BowelMet
 	args := []any{userID, bowelMetric.Time, bowelMetric.Pain, bowelMetric.Type, bowelMetric.Date, pq.Array(bowelMetric.Tags)}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
 }
 
 func (m BowelMetricModel) UpdateBowelMetric(bowelMetric *BowelMetric) error {
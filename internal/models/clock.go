@@ -0,0 +1,43 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// clockLayouts are the ways the apps write a time of day.
+var clockLayouts = []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", "3:04 pm", "3:04pm"}
+
+// timestampLayouts are the ways the apps write a full date and time. An offset is
+// ignored: times are kept in the wall-clock time of the user.
+var timestampLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// ParseClock() reads a time of day, returning the time since midnight.
+func ParseClock(value string) (time.Duration, error) {
+	var err error
+	for _, layout := range clockLayouts {
+		var t time.Time
+		t, err = time.Parse(layout, strings.TrimSpace(value))
+		if err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, err
+}
+
+// parseTimeOn() reads a full timestamp, or a time of day on the given day, and
+// tells whether it was a time of day.
+func parseTimeOn(day time.Time, value string) (time.Time, bool, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), false, true
+		}
+	}
+	offset, err := ParseClock(value)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC).Add(offset), true, true
+}
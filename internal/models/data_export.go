@@ -0,0 +1,514 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// DataExport is an export job. The archive is only loaded by Get().
+type DataExport struct {
+	ID          int64      `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Archive     []byte     `json:"-"`
+}
+
+type PointRecord struct {
+	Point int64     `json:"point"`
+	Scope string    `json:"scope"`
+	Date  time.Time `json:"date"`
+}
+
+// UserData is everything stored about a user. SymptomMetrics carry the symptom id
+// rather than the id of the record, so they can be imported again. Only the hash of
+// the calendar feed token is stored, so the feed is described by its expiry alone.
+type UserData struct {
+	ExportedAt              time.Time                `json:"exported_at"`
+	Profile                 *User                    `json:"profile"`
+	TrackedMetrics          []*Metrics               `json:"tracked_metrics"`
+	Conditions              []*Conditions            `json:"conditions"`
+	Symptoms                []*Symptoms              `json:"symptoms"`
+	CustomMedications       []*Medication            `json:"custom_medications"`
+	Menses                  *Menses                  `json:"menses"`
+	BodyMeasure             *BodyMeasure             `json:"body_measure"`
+	NotificationPreferences *NotificationPreferences `json:"notification_preferences"`
+	TrackingMode            *TrackingMode            `json:"tracking_mode"`
+	CalendarFeedExpiry      *time.Time               `json:"calendar_feed_expiry"`
+	SymptomMetrics          []*SymsMetric            `json:"symptom_metrics"`
+	SleepMetrics            []*SleepMetric           `json:"sleep_metrics"`
+	FoodMetrics             []*FoodMetric            `json:"food_metrics"`
+	ExerciseMetrics         []*ExerciseMetric        `json:"exercise_metrics"`
+	UrineMetrics            []*UrineMetric           `json:"urine_metrics"`
+	HydrationMetrics        []*HydrationMetric       `json:"hydration_metrics"`
+	BowelMetrics            []*BowelMetric           `json:"bowel_metrics"`
+	MedicationMetrics       []*MedicationMetric      `json:"medication_metrics"`
+	MedicationPlans         []*MedicationPlan        `json:"medication_plans"`
+	MedicationDoses         []Dose                   `json:"medication_doses"`
+	Smileys                 []*Smileys               `json:"smileys"`
+	MenstrualCycles         []MenstrualCycle         `json:"menstrual_cycles"`
+	CycleDays               []CycleDay               `json:"cycle_days"`
+	TotalPoints             int64                    `json:"total_points"`
+	PointRecords            []*PointRecord           `json:"point_records"`
+}
+
+type DataExportModel struct {
+	DB *sql.DB
+}
+
+func (m DataExportModel) Insert(userID string) (*DataExport, error) {
+	query := ` INSERT INTO data_exports (user_id, status) VALUES ($1, $2) RETURNING id, status, created_at`
+	var export DataExport
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID, ExportStatusPending).Scan(&export.ID, &export.Status, &export.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (m DataExportModel) Get(id int64, userID string) (*DataExport, error) {
+	query := ` SELECT id, status, created_at, completed_at, archive FROM data_exports WHERE id = $1 AND user_id = $2`
+	var export DataExport
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&export.ID,
+		&export.Status,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.Archive)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &export, nil
+}
+
+func (m DataExportModel) Complete(id int64, archive []byte) error {
+	query := ` UPDATE data_exports SET status = $2, archive = $3, completed_at = NOW() WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, ExportStatusCompleted, archive)
+	return err
+}
+
+func (m DataExportModel) Fail(id int64) error {
+	query := ` UPDATE data_exports SET status = $2, completed_at = NOW() WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, ExportStatusFailed)
+	return err
+}
+
+func (m DataExportModel) DeleteOlderThan(before time.Time) error {
+	query := ` DELETE FROM data_exports WHERE created_at < $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, before)
+	return err
+}
+
+// GetUserData() gathers every record owned by the user.
+func (m DataExportModel) GetUserData(user *User) (*UserData, error) {
+	data := &UserData{ExportedAt: time.Now(), Profile: user}
+	var err error
+
+	data.TrackedMetrics, err = MetricsModel{DB: m.DB}.GetUserMetrics(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	data.Conditions, err = ConditionsModel{DB: m.DB}.GetUserConditions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	data.Symptoms, err = SymptomsModel{DB: m.DB}.GetUserSymptoms(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	data.CustomMedications, err = MedicationModel{DB: m.DB}.GetCustom(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	data.Menses, err = MensesModels{DB: m.DB}.GetMenses(user.ID)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		return nil, err
+	}
+	data.BodyMeasure, err = BodyMeasureModel{DB: m.DB}.GetBodyMeasure(user.ID)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		return nil, err
+	}
+	data.NotificationPreferences, err = NotificationModel{DB: m.DB}.GetPreferences(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	data.TrackingMode, err = (&UserPeriodModel{DB: m.DB}).GetTrackingMode(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	data.MedicationPlans, err = MedicationPlanModel{DB: m.DB}.GetAll(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	data.Smileys, err = SmileysModel{DB: m.DB}.GetUserSmileys(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	data.MenstrualCycles, err = (&UserPeriodModel{DB: m.DB}).GetMenstrualCycles(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if data.MenstrualCycles == nil {
+		data.MenstrualCycles = []MenstrualCycle{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if data.SymptomMetrics, err = m.getSymsMetrics(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.SleepMetrics, err = m.getSleepMetrics(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.FoodMetrics, err = m.getFoodMetrics(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.ExerciseMetrics, err = m.getExerciseMetrics(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.UrineMetrics, err = m.getUrineMetrics(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.HydrationMetrics, err = m.getHydrationMetrics(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.BowelMetrics, err = m.getBowelMetrics(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.MedicationMetrics, err = m.getMedicationMetrics(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.MedicationDoses, err = m.getMedicationDoses(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.CycleDays, err = m.getCycleDays(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if data.PointRecords, err = m.getPointRecords(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	err = m.DB.QueryRowContext(ctx, ` SELECT COALESCE(SUM(tot_point), 0) FROM user_point WHERE user_id = $1`, user.ID).Scan(&data.TotalPoints)
+	if err != nil {
+		return nil, err
+	}
+	err = m.DB.QueryRowContext(ctx, ` SELECT MAX(expiry) FROM tokens WHERE scope = $1 AND user_id = $2`,
+		ScopeCalendarFeed, user.ID).Scan(&data.CalendarFeedExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (m DataExportModel) getSymsMetrics(ctx context.Context, userID string) ([]*SymsMetric, error) {
+	query := `
+	SELECT usm.symptoms_id, s.name, usm.date, usm.morning_severity, usm.afternoon_severity, usm.night_severity
+	FROM user_symptoms_metric usm
+	JOIN symptoms s ON usm.symptoms_id = s.id
+	WHERE usm.user_id = $1 ORDER BY usm.date`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	symsMetrics := []*SymsMetric{}
+	for rows.Next() {
+		var symsMetric SymsMetric
+		err := rows.Scan(&symsMetric.Id, &symsMetric.Name, &symsMetric.Date, &symsMetric.MorningSeverity, &symsMetric.AfternoonSeverity, &symsMetric.NightSeverity)
+		if err != nil {
+			return nil, err
+		}
+		symsMetrics = append(symsMetrics, &symsMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return symsMetrics, nil
+}
+
+func (m DataExportModel) getSleepMetrics(ctx context.Context, userID string) ([]*SleepMetric, error) {
+	query := `
+	SELECT id, is_night, slept_at, woke_at, tags, date, severity
+	FROM user_sleep_metric WHERE user_id = $1 ORDER BY date, slept_at`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sleepMetrics := []*SleepMetric{}
+	for rows.Next() {
+		var sleepMetric SleepMetric
+		err := rows.Scan(&sleepMetric.ID, &sleepMetric.IsNight, &sleepMetric.SleptAt, &sleepMetric.WokeAt, pq.Array(&sleepMetric.Tags), &sleepMetric.Date, &sleepMetric.Severity)
+		if err != nil {
+			return nil, err
+		}
+		sleepMetric.setDuration()
+		sleepMetrics = append(sleepMetrics, &sleepMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sleepMetrics, nil
+}
+
+func (m DataExportModel) getFoodMetrics(ctx context.Context, userID string) ([]*FoodMetric, error) {
+	query := `
+	SELECT id, user_id, date, breakfast_meal, lunch_meal, dinner_meal, breakfast_extra, lunch_extra, dinner_extra, breakfast_fruit, lunch_fruit, dinner_fruit, breakfast_tags, lunch_tags, dinner_tags, snack_name, snack_tags, glass_no
+	FROM user_food_metric WHERE user_id = $1 ORDER BY date`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	foodMetrics := []*FoodMetric{}
+	for rows.Next() {
+		var foodMetric FoodMetric
+		err := rows.Scan(
+			&foodMetric.ID,
+			&foodMetric.UserID,
+			&foodMetric.Date,
+			&foodMetric.BreakfastMeal,
+			&foodMetric.LunchMeal,
+			&foodMetric.DinnerMeal,
+			&foodMetric.BreakfastExtra,
+			&foodMetric.LunchExtra,
+			&foodMetric.DinnerExtra,
+			&foodMetric.BreakfastFruit,
+			&foodMetric.LunchFruit,
+			&foodMetric.DinnerFruit,
+			pq.Array(&foodMetric.BreakfastTags),
+			pq.Array(&foodMetric.LunchTags),
+			pq.Array(&foodMetric.DinnerTags),
+			&foodMetric.SnackName,
+			pq.Array(&foodMetric.SnackTags),
+			&foodMetric.GlassNo)
+		if err != nil {
+			return nil, err
+		}
+		foodMetrics = append(foodMetrics, &foodMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return foodMetrics, nil
+}
+
+func (m DataExportModel) getExerciseMetrics(ctx context.Context, userID string) ([]*ExerciseMetric, error) {
+	query := `
+	SELECT id, name, started_at, ended_at, intensity, tags, date, no_of_times
+	FROM user_exercise_metric WHERE user_id = $1 ORDER BY date, started_at`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	exerciseMetrics := []*ExerciseMetric{}
+	for rows.Next() {
+		var exerciseMetric ExerciseMetric
+		err := rows.Scan(&exerciseMetric.ID, &exerciseMetric.Name, &exerciseMetric.StartedAt, &exerciseMetric.EndedAt, &exerciseMetric.Intensity, pq.Array(&exerciseMetric.Tags), &exerciseMetric.Date, &exerciseMetric.NoOfTimes)
+		if err != nil {
+			return nil, err
+		}
+		exerciseMetric.setDuration()
+		exerciseMetrics = append(exerciseMetrics, &exerciseMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return exerciseMetrics, nil
+}
+
+func (m DataExportModel) getUrineMetrics(ctx context.Context, userID string) ([]*UrineMetric, error) {
+	query := `
+	SELECT id, time, type, pain, tags, date, quantity
+	FROM user_urine_metric WHERE user_id = $1 ORDER BY date`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	urineMetrics := []*UrineMetric{}
+	for rows.Next() {
+		var urineMetric UrineMetric
+		err := rows.Scan(&urineMetric.ID, &urineMetric.Time, &urineMetric.Type, &urineMetric.Pain, pq.Array(&urineMetric.Tags), &urineMetric.Date, &urineMetric.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		urineMetrics = append(urineMetrics, &urineMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return urineMetrics, nil
+}
+
+func (m DataExportModel) getHydrationMetrics(ctx context.Context, userID string) ([]*HydrationMetric, error) {
+	query := `
+	SELECT id, date, drunk_at, volume_ml, beverage
+	FROM user_hydration_metric WHERE user_id = $1 ORDER BY drunk_at`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hydrationMetrics := []*HydrationMetric{}
+	for rows.Next() {
+		var hydrationMetric HydrationMetric
+		err := rows.Scan(&hydrationMetric.ID, &hydrationMetric.Date, &hydrationMetric.DrunkAt, &hydrationMetric.VolumeML, &hydrationMetric.Beverage)
+		if err != nil {
+			return nil, err
+		}
+		hydrationMetric.setTime()
+		hydrationMetrics = append(hydrationMetrics, &hydrationMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return hydrationMetrics, nil
+}
+
+func (m DataExportModel) getBowelMetrics(ctx context.Context, userID string) ([]*BowelMetric, error) {
+	query := `
+	SELECT id, time, type, pain, tags, date
+	FROM user_bowel_metric WHERE user_id = $1 ORDER BY date`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bowelMetrics := []*BowelMetric{}
+	for rows.Next() {
+		var bowelMetric BowelMetric
+		err := rows.Scan(&bowelMetric.ID, &bowelMetric.Time, &bowelMetric.Type, &bowelMetric.Pain, pq.Array(&bowelMetric.Tags), &bowelMetric.Date)
+		if err != nil {
+			return nil, err
+		}
+		bowelMetrics = append(bowelMetrics, &bowelMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return bowelMetrics, nil
+}
+
+func (m DataExportModel) getMedicationMetrics(ctx context.Context, userID string) ([]*MedicationMetric, error) {
+	query := `
+	SELECT id, time, name, metric, date, dosage, quantity
+	FROM user_medication_metric WHERE user_id = $1 ORDER BY date`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	medicationMetrics := []*MedicationMetric{}
+	for rows.Next() {
+		var medicationMetric MedicationMetric
+		err := rows.Scan(&medicationMetric.ID, &medicationMetric.Time, &medicationMetric.Name, &medicationMetric.Metric, &medicationMetric.Date, &medicationMetric.Dosage, &medicationMetric.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		medicationMetrics = append(medicationMetrics, &medicationMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return medicationMetrics, nil
+}
+
+func (m DataExportModel) getMedicationDoses(ctx context.Context, userID string) ([]Dose, error) {
+	query := `
+	SELECT d.plan_id, p.name, d.scheduled_at, d.status, d.metric_id, d.recorded_at
+	FROM medication_doses d
+	JOIN medication_plans p ON p.id = d.plan_id
+	WHERE d.user_id = $1 ORDER BY d.scheduled_at`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	doses := []Dose{}
+	for rows.Next() {
+		var dose Dose
+		err := rows.Scan(&dose.PlanID, &dose.Name, &dose.ScheduledAt, &dose.Status, &dose.MetricID, &dose.RecordedAt)
+		if err != nil {
+			return nil, err
+		}
+		dose.ScheduledAt = dose.ScheduledAt.UTC()
+		doses = append(doses, dose)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return doses, nil
+}
+
+func (m DataExportModel) getCycleDays(ctx context.Context, userID string) ([]CycleDay, error) {
+	query := `
+	SELECT id, cycle_id, date, is_period, is_ovulation, ovulation_set_by_user, is_fertile, is_luteal, flow, pain, tags, cmq, temperature, cervical_mucus
+	FROM cycles_days WHERE user_id = $1 ORDER BY date`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	days := []CycleDay{}
+	for rows.Next() {
+		var day CycleDay
+		err := rows.Scan(&day.ID, &day.CycleID, &day.Date, &day.IsPeriod, &day.IsOvulation, &day.OvulationSetByUser, &day.IsFertile, &day.IsLuteal, &day.Flow, &day.Pain, pq.Array(&day.Tags), &day.CMQ, &day.Temperature, &day.CervicalMucus)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return days, nil
+}
+
+func (m DataExportModel) getPointRecords(ctx context.Context, userID string) ([]*PointRecord, error) {
+	query := ` SELECT point, COALESCE(scope, ''), date FROM user_point_record WHERE user_id = $1 ORDER BY date`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []*PointRecord{}
+	for rows.Next() {
+		var record PointRecord
+		err := rows.Scan(&record.Point, &record.Scope, &record.Date)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
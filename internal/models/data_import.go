@@ -0,0 +1,381 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportSkipped = "skipped"
+	ImportFailed  = "failed"
+)
+
+// DataImportModel writes records from an export back, matching each record against
+// the user's existing rows by its natural key (e.g. date and time of a urine entry)
+// since the ids in an export belong to the database it came from.
+type DataImportModel struct {
+	DB *sql.DB
+}
+
+// importRow describes how to find, update and insert one imported record. The id of
+// the matched row is handed to updateArgs.
+type importRow struct {
+	find       string
+	findArgs   []any
+	update     string
+	updateArgs func(id string) []any
+	insert     func() error
+}
+
+func (r importRow) applyTx(tx *sql.Tx, overwrite bool) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var id string
+	err := tx.QueryRowContext(ctx, r.find, r.findArgs...).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = r.insert()
+		if err != nil {
+			return ImportFailed, err
+		}
+		return ImportCreated, nil
+	case err != nil:
+		return ImportFailed, err
+	}
+	if !overwrite {
+		return ImportSkipped, nil
+	}
+	_, err = tx.ExecContext(ctx, r.update, r.updateArgs(id)...)
+	if err != nil {
+		return ImportFailed, err
+	}
+	return ImportUpdated, nil
+}
+
+// importMembershipTx adds the user to a set such as their conditions, unless they
+// are already in it.
+func importMembershipTx(tx *sql.Tx, exists string, userID string, id int, insert func() error) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var found bool
+	err := tx.QueryRowContext(ctx, exists, userID, id).Scan(&found)
+	if err != nil {
+		return ImportFailed, err
+	}
+	if found {
+		return ImportSkipped, nil
+	}
+	err = insert()
+	if err != nil {
+		return ImportFailed, err
+	}
+	return ImportCreated, nil
+}
+
+func (m DataImportModel) ImportUserMetricTx(tx *sql.Tx, userID string, metricID int) (string, error) {
+	return importMembershipTx(tx, ` SELECT EXISTS (SELECT 1 FROM user_trackedmetric WHERE user_id = $1 AND metric_id = $2)`, userID, metricID, func() error {
+		return MetricsModel{DB: m.DB}.SetUserMetrics(tx, metricID, userID)
+	})
+}
+
+func (m DataImportModel) ImportUserConditionTx(tx *sql.Tx, userID string, conditionID int) (string, error) {
+	return importMembershipTx(tx, ` SELECT EXISTS (SELECT 1 FROM user_conditions WHERE user_id = $1 AND conditions_id = $2)`, userID, conditionID, func() error {
+		return ConditionsModel{DB: m.DB}.SetUserConditions(tx, conditionID, userID)
+	})
+}
+
+func (m DataImportModel) ImportUserSymptomTx(tx *sql.Tx, userID string, symptomID int) (string, error) {
+	return importMembershipTx(tx, ` SELECT EXISTS (SELECT 1 FROM user_symptoms WHERE user_id = $1 AND symptoms_id = $2)`, userID, symptomID, func() error {
+		return SymptomsModel{DB: m.DB}.SetUserSymptoms(tx, symptomID, userID)
+	})
+}
+
+// ImportCustomMedicationTx() matches custom medications by name, ignoring case.
+func (m DataImportModel) ImportCustomMedicationTx(tx *sql.Tx, userID string, medication *Medication, overwrite bool) (string, error) {
+	medication.UserID = userID
+	return importRow{
+		find:     ` SELECT id FROM medications WHERE user_id = $1 AND lower(name) = lower($2)`,
+		findArgs: []any{userID, strings.TrimSpace(medication.Name)},
+		update:   ` UPDATE medications SET forms = $2, units = $3 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, pq.Array(medication.Forms), pq.Array(medication.Units)}
+		},
+		insert: func() error { return MedicationModel{DB: m.DB}.InsertCustomTx(tx, medication) },
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportMensesTx(tx *sql.Tx, userID string, menses *Menses, overwrite bool) (string, error) {
+	menses.Id = userID
+	return importRow{
+		find:     ` SELECT user_id FROM menstruation WHERE user_id = $1`,
+		findArgs: []any{userID},
+		update:   ` UPDATE menstruation SET period_len = $2, cycle_len = $3 WHERE user_id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, menses.Period_len, menses.Cycle_len}
+		},
+		insert: func() error { return MensesModels{DB: m.DB}.InsertMensesTx(tx, menses) },
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportBodyMeasureTx(tx *sql.Tx, userID string, bodyMeasure *BodyMeasure, overwrite bool) (string, error) {
+	bodyMeasure.Id = userID
+	return importRow{
+		find:     ` SELECT user_id FROM bodymeasure WHERE user_id = $1`,
+		findArgs: []any{userID},
+		update:   ` UPDATE bodymeasure SET height = $2, weight = $3 WHERE user_id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, bodyMeasure.Height, bodyMeasure.Weight}
+		},
+		insert: func() error { return BodyMeasureModel{DB: m.DB}.InsertBodyMeasureTx(tx, bodyMeasure) },
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportSymsMetricTx(tx *sql.Tx, userID string, symsMetric *SymsMetric, overwrite bool) (string, error) {
+	return importRow{
+		find:     ` SELECT id FROM user_symptoms_metric WHERE user_id = $1 AND symptoms_id = $2 AND date = $3`,
+		findArgs: []any{userID, symsMetric.Id, symsMetric.Date},
+		update:   ` UPDATE user_symptoms_metric SET morning_severity = $2, afternoon_severity = $3, night_severity = $4 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, symsMetric.MorningSeverity, symsMetric.AfternoonSeverity, symsMetric.NightSeverity}
+		},
+		insert: func() error { return SymsMetricModel{DB: m.DB}.CreateSymsMetricTx(tx, userID, *symsMetric) },
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportSleepMetricTx(tx *sql.Tx, userID string, sleepMetric *SleepMetric, overwrite bool) (string, error) {
+	return importRow{
+		find:     ` SELECT id FROM user_sleep_metric WHERE user_id = $1 AND date = $2 AND is_night = $3 AND slept_at IS NOT DISTINCT FROM $4`,
+		findArgs: []any{userID, sleepMetric.Date, sleepMetric.IsNight, sleepMetric.SleptAt},
+		update:   ` UPDATE user_sleep_metric SET woke_at = $2, tags = $3, severity = $4 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, sleepMetric.WokeAt, pq.Array(sleepMetric.Tags), sleepMetric.Severity}
+		},
+		insert: func() error { return SleepMetricModel{DB: m.DB}.InsertSleepMetricTx(tx, userID, sleepMetric) },
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportFoodMetricTx(tx *sql.Tx, userID string, foodMetric *FoodMetric, overwrite bool) (string, error) {
+	foodMetric.UserID = userID
+	return importRow{
+		find:     ` SELECT id FROM user_food_metric WHERE user_id = $1 AND date = $2`,
+		findArgs: []any{userID, foodMetric.Date},
+		update: `
+		UPDATE user_food_metric
+		SET breakfast_meal = $2, lunch_meal = $3, dinner_meal = $4, breakfast_extra = $5, lunch_extra = $6, dinner_extra = $7,
+			breakfast_fruit = $8, lunch_fruit = $9, dinner_fruit = $10, breakfast_tags = $11, lunch_tags = $12, dinner_tags = $13,
+			snack_name = $14, snack_tags = $15, glass_no = $16
+		WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{
+				id,
+				foodMetric.BreakfastMeal,
+				foodMetric.LunchMeal,
+				foodMetric.DinnerMeal,
+				foodMetric.BreakfastExtra,
+				foodMetric.LunchExtra,
+				foodMetric.DinnerExtra,
+				foodMetric.BreakfastFruit,
+				foodMetric.LunchFruit,
+				foodMetric.DinnerFruit,
+				pq.Array(foodMetric.BreakfastTags),
+				pq.Array(foodMetric.LunchTags),
+				pq.Array(foodMetric.DinnerTags),
+				foodMetric.SnackName,
+				pq.Array(foodMetric.SnackTags),
+				foodMetric.GlassNo,
+			}
+		},
+		insert: func() error { return FoodMetricModel{DB: m.DB}.InsertFoodMetricTx(tx, foodMetric) },
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportExerciseMetricTx(tx *sql.Tx, userID string, exerciseMetric *ExerciseMetric, overwrite bool) (string, error) {
+	exerciseMetric.UserID = userID
+	return importRow{
+		find:     ` SELECT id FROM user_exercise_metric WHERE user_id = $1 AND date = $2 AND name = $3 AND started_at IS NOT DISTINCT FROM $4`,
+		findArgs: []any{userID, exerciseMetric.Date, exerciseMetric.Name, exerciseMetric.StartedAt},
+		update:   ` UPDATE user_exercise_metric SET ended_at = $2, intensity = $3, tags = $4, no_of_times = $5 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, exerciseMetric.EndedAt, exerciseMetric.Intensity, pq.Array(exerciseMetric.Tags), exerciseMetric.NoOfTimes}
+		},
+		insert: func() error { return ExerciseMetricModel{DB: m.DB}.InsertExerciseMetricTx(tx, exerciseMetric) },
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportUrineMetricTx(tx *sql.Tx, userID string, urineMetric *UrineMetric, overwrite bool) (string, error) {
+	return importRow{
+		find:     ` SELECT id FROM user_urine_metric WHERE user_id = $1 AND date = $2 AND time = $3`,
+		findArgs: []any{userID, urineMetric.Date, urineMetric.Time},
+		update:   ` UPDATE user_urine_metric SET pain = $2, type = $3, tags = $4, quantity = $5 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, urineMetric.Pain, urineMetric.Type, pq.Array(urineMetric.Tags), urineMetric.Quantity}
+		},
+		insert: func() error { return UrineMetricModel{DB: m.DB}.InsertUrineMetricTx(tx, userID, urineMetric) },
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportHydrationMetricTx(tx *sql.Tx, userID string, hydrationMetric *HydrationMetric, overwrite bool) (string, error) {
+	return importRow{
+		find:     ` SELECT id FROM user_hydration_metric WHERE user_id = $1 AND drunk_at = $2 AND beverage = $3`,
+		findArgs: []any{userID, hydrationMetric.DrunkAt, hydrationMetric.Beverage},
+		update:   ` UPDATE user_hydration_metric SET date = $2, volume_ml = $3 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, hydrationMetric.Date, hydrationMetric.VolumeML}
+		},
+		insert: func() error {
+			return HydrationMetricModel{DB: m.DB}.InsertHydrationMetricTx(tx, userID, hydrationMetric)
+		},
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportBowelMetricTx(tx *sql.Tx, userID string, bowelMetric *BowelMetric, overwrite bool) (string, error) {
+	return importRow{
+		find:     ` SELECT id FROM user_bowel_metric WHERE user_id = $1 AND date = $2 AND time = $3`,
+		findArgs: []any{userID, bowelMetric.Date, bowelMetric.Time},
+		update:   ` UPDATE user_bowel_metric SET pain = $2, type = $3, tags = $4 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, bowelMetric.Pain, bowelMetric.Type, pq.Array(bowelMetric.Tags)}
+		},
+		insert: func() error { return BowelMetricModel{DB: m.DB}.InsertBowelMetricTx(tx, userID, bowelMetric) },
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportMedicationMetricTx(tx *sql.Tx, userID string, medicationMetric *MedicationMetric, overwrite bool) (string, error) {
+	return importRow{
+		find:     ` SELECT id FROM user_medication_metric WHERE user_id = $1 AND date = $2 AND name = $3 AND time = $4`,
+		findArgs: []any{userID, medicationMetric.Date, medicationMetric.Name, medicationMetric.Time},
+		update:   ` UPDATE user_medication_metric SET dosage = $2, quantity = $3, metric = $4 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, medicationMetric.Dosage, medicationMetric.Quantity, medicationMetric.Metric}
+		},
+		insert: func() error {
+			return MedicationMetricModel{DB: m.DB}.InsertMedicationMetricTx(tx, userID, medicationMetric)
+		},
+	}.applyTx(tx, overwrite)
+}
+
+// ImportMedicationPlanTx() returns the id the plan has in this database, which the
+// imported doses have to be attached to. Plans are matched by name and start date.
+func (m DataImportModel) ImportMedicationPlanTx(tx *sql.Tx, userID string, plan *MedicationPlan, overwrite bool) (int64, string, error) {
+	plan.UserID = userID
+	var planID int64
+	status, err := importRow{
+		find:     ` SELECT id FROM medication_plans WHERE user_id = $1 AND name = $2 AND start_date = $3`,
+		findArgs: []any{userID, plan.Name, plan.StartDate},
+		update: ` UPDATE medication_plans SET dose = $2, unit = $3, frequency = $4, times = $5, end_date = $6,
+		reminders = $7, version = version + 1 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, plan.Dose, plan.Unit, plan.Frequency, pq.Array(plan.Times), plan.EndDate, plan.Reminders}
+		},
+		insert: func() error { return MedicationPlanModel{DB: m.DB}.InsertTx(tx, plan) },
+	}.applyTx(tx, overwrite)
+	if status == ImportCreated {
+		return plan.ID, status, nil
+	}
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		err = tx.QueryRowContext(ctx, ` SELECT id FROM medication_plans WHERE user_id = $1 AND name = $2 AND start_date = $3`,
+			userID, plan.Name, plan.StartDate).Scan(&planID)
+		if err != nil {
+			return 0, ImportFailed, err
+		}
+	}
+	return planID, status, err
+}
+
+// ImportMedicationDoseTx() expects dose.PlanID to already be the id of the plan in
+// this database. metric is the exported medication metric the dose was logged as,
+// if any; it is linked again when it was imported too.
+func (m DataImportModel) ImportMedicationDoseTx(tx *sql.Tx, userID string, dose *Dose, metric *MedicationMetric, overwrite bool) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var metricID *int
+	if metric != nil {
+		err := tx.QueryRowContext(ctx, ` SELECT id FROM user_medication_metric WHERE user_id = $1 AND date = $2 AND name = $3 AND time = $4`,
+			userID, metric.Date, metric.Name, metric.Time).Scan(&metricID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return ImportFailed, err
+		}
+	}
+	return importRow{
+		find:     ` SELECT plan_id FROM medication_doses WHERE plan_id = $1 AND scheduled_at = $2`,
+		findArgs: []any{dose.PlanID, dose.ScheduledAt},
+		update:   ` UPDATE medication_doses SET status = $3, metric_id = $4 WHERE plan_id = $1 AND scheduled_at = $2`,
+		updateArgs: func(string) []any {
+			return []any{dose.PlanID, dose.ScheduledAt, dose.Status, metricID}
+		},
+		insert: func() error {
+			_, err := tx.ExecContext(ctx, `
+			INSERT INTO medication_doses (plan_id, user_id, scheduled_at, status, metric_id)
+			VALUES ($1, $2, $3, $4, $5)`, dose.PlanID, userID, dose.ScheduledAt, dose.Status, metricID)
+			return err
+		},
+	}.applyTx(tx, overwrite)
+}
+
+func (m DataImportModel) ImportSmileyTx(tx *sql.Tx, userID string, smiley *Smileys, overwrite bool) (string, error) {
+	return importRow{
+		find:     ` SELECT smiley_id FROM user_smiley WHERE user_id = $1 AND smiley_id = $2 AND granted_at = $3`,
+		findArgs: []any{userID, smiley.Id, smiley.Time},
+		update:   ` UPDATE user_smiley SET tags = $1 WHERE user_id = $2 AND smiley_id = $3 AND granted_at = $4`,
+		updateArgs: func(string) []any {
+			return []any{pq.Array(smiley.Tags), userID, smiley.Id, smiley.Time}
+		},
+		insert: func() error { return SmileysModel{DB: m.DB}.InsertUserSmileysTx(tx, userID, *smiley, smiley.Time) },
+	}.applyTx(tx, overwrite)
+}
+
+// ImportMenstrualCycleTx() returns the id the cycle has in this database, which the
+// imported cycle days have to be attached to.
+func (m DataImportModel) ImportMenstrualCycleTx(tx *sql.Tx, userID string, cycle *MenstrualCycle, overwrite bool) (string, string, error) {
+	cycle.UserID = userID
+	var cycleID string
+	status, err := importRow{
+		find:     ` SELECT id FROM menstrual_cycles WHERE user_id = $1 AND start_date = $2`,
+		findArgs: []any{userID, cycle.StartDate},
+		update:   ` UPDATE menstrual_cycles SET cycle_length = $2, period_length = $3 WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			cycleID = id
+			return []any{id, cycle.CycleLength, cycle.PeriodLength}
+		},
+		insert: func() error {
+			var err error
+			cycleID, err = (&UserPeriodModel{DB: m.DB}).InsertMenstrualCycleTx(tx, cycle)
+			return err
+		},
+	}.applyTx(tx, overwrite)
+	if status == ImportSkipped {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		err = tx.QueryRowContext(ctx, ` SELECT id FROM menstrual_cycles WHERE user_id = $1 AND start_date = $2`, userID, cycle.StartDate).Scan(&cycleID)
+		if err != nil {
+			return "", ImportFailed, err
+		}
+	}
+	return cycleID, status, err
+}
+
+// ImportCycleDayTx() expects day.CycleID to already be the id of the cycle in this
+// database.
+func (m DataImportModel) ImportCycleDayTx(tx *sql.Tx, userID string, day *CycleDay, overwrite bool) (string, error) {
+	day.UserID = userID
+	return importRow{
+		find:     ` SELECT id FROM cycles_days WHERE user_id = $1 AND date = $2`,
+		findArgs: []any{userID, day.Date},
+		update: ` UPDATE cycles_days SET cycle_id = $2, is_period = $3, is_ovulation = $4, is_fertile = $5, is_luteal = $6,
+		flow = $7, pain = $8, tags = $9, cmq = $10, temperature = $11, cervical_mucus = $12, ovulation_set_by_user = $13
+		WHERE id = $1`,
+		updateArgs: func(id string) []any {
+			return []any{id, day.CycleID, day.IsPeriod, day.IsOvulation, day.IsFertile, day.IsLuteal, day.Flow, day.Pain, pq.Array(day.Tags), day.CMQ, day.Temperature, day.CervicalMucus, day.OvulationSetByUser}
+		},
+		insert: func() error { return (&UserPeriodModel{DB: m.DB}).InsertCycleDayTx(tx, day) },
+	}.applyTx(tx, overwrite)
+}
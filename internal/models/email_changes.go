@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// EmailChangeModel holds the address a user asked to switch to until they confirm
+// it with the token sent there.
+type EmailChangeModel struct {
+	DB *sql.DB
+}
+
+// Insert() replaces any earlier pending change of the user.
+func (m EmailChangeModel) Insert(userID, newEmail string) error {
+	query := `
+	INSERT INTO user_email_changes (user_id, new_email)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id)
+	DO UPDATE SET new_email = EXCLUDED.new_email, created_at = NOW()`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, newEmail)
+	return err
+}
+
+func (m EmailChangeModel) Get(userID string) (string, error) {
+	query := ` SELECT new_email FROM user_email_changes WHERE user_id = $1`
+	var newEmail string
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&newEmail)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return newEmail, nil
+}
+
+func (m EmailChangeModel) Delete(userID string) error {
+	query := ` DELETE FROM user_email_changes WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -4,20 +4,151 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/olagookundavid/itoju/internal/validator"
 )
 
+const (
+	IntensityLight    = "light"
+	IntensityModerate = "moderate"
+	IntensityVigorous = "vigorous"
+)
+
+var ExerciseIntensities = []string{IntensityLight, IntensityModerate, IntensityVigorous}
+
+// maxExercise is the longest a single exercise entry may last.
+const maxExercise = 24 * time.Hour
+
+// intensityMETs are the metabolic equivalents of an activity that isn't known, by
+// intensity.
+var intensityMETs = map[string]float64{IntensityLight: 2.5, IntensityModerate: 4.5, IntensityVigorous: 8}
+
+// activityMETs are the metabolic equivalents of common activities, by intensity,
+// after the Compendium of Physical Activities. An exercise is matched by the first
+// keyword its name contains.
+var activityMETs = []struct {
+	keywords []string
+	mets     map[string]float64
+}{
+	{[]string{"walk"}, map[string]float64{IntensityLight: 2.8, IntensityModerate: 3.5, IntensityVigorous: 5}},
+	{[]string{"run", "jog"}, map[string]float64{IntensityLight: 7, IntensityModerate: 9.8, IntensityVigorous: 11.5}},
+	{[]string{"cycl", "bik"}, map[string]float64{IntensityLight: 4, IntensityModerate: 6.8, IntensityVigorous: 10}},
+	{[]string{"swim"}, map[string]float64{IntensityLight: 4.8, IntensityModerate: 5.8, IntensityVigorous: 9.8}},
+	{[]string{"hik"}, map[string]float64{IntensityLight: 5.3, IntensityModerate: 6, IntensityVigorous: 7.8}},
+	{[]string{"danc", "zumba", "aerobic"}, map[string]float64{IntensityLight: 3, IntensityModerate: 5, IntensityVigorous: 7.3}},
+	{[]string{"yoga", "stretch"}, map[string]float64{IntensityLight: 2, IntensityModerate: 2.5, IntensityVigorous: 4}},
+	{[]string{"pilates"}, map[string]float64{IntensityLight: 2.8, IntensityModerate: 3, IntensityVigorous: 3.8}},
+	{[]string{"weight", "strength", "gym", "lift"}, map[string]float64{IntensityLight: 3.5, IntensityModerate: 5, IntensityVigorous: 6}},
+}
+
+// ExerciseMetric is an exercise of a day. Started and Ended are the times of day
+// of StartedAt and EndedAt, which stay empty until the exercise is completed.
+// Calories is only known once the user saved their weight.
 type ExerciseMetric struct {
-	ID        int       `json:"id"`
-	UserID    string    `json:"-"`
-	Date      time.Time `json:"date"`
-	Name      string    `json:"name"`
-	Started   string    `json:"start"`
-	Ended     string    `json:"ended"`
-	Tags      []string  `json:"tags"`
-	NoOfTimes int       `json:"no_of_times"`
+	ID              int        `json:"id"`
+	UserID          string     `json:"-"`
+	Date            time.Time  `json:"date"`
+	Name            string     `json:"name"`
+	Started         string     `json:"start"`
+	Ended           string     `json:"ended"`
+	StartedAt       *time.Time `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Intensity       string     `json:"intensity"`
+	MET             float64    `json:"met"`
+	Calories        *int       `json:"calories"`
+	Tags            []string   `json:"tags"`
+	NoOfTimes       int        `json:"no_of_times"`
+}
+
+// ReadExerciseTimes() sets StartedAt and EndedAt from what the apps send for them:
+// full timestamps, or times of day. An empty value clears the time. A time of day
+// for starting falls on the date of the entry, and a time of day for ending that
+// isn't after the start falls on the day after, the exercise having crossed
+// midnight.
+func ReadExerciseTimes(v *validator.Validator, exerciseMetric *ExerciseMetric, started, ended string) {
+	exerciseMetric.StartedAt, exerciseMetric.EndedAt = nil, nil
+	exerciseMetric.Started, exerciseMetric.Ended, exerciseMetric.DurationMinutes = "", "", 0
+	if strings.TrimSpace(started) == "" {
+		v.Check(strings.TrimSpace(ended) == "", "start", "must be provided with ended")
+		return
+	}
+	startedAt, _, ok := parseTimeOn(exerciseMetric.Date, started)
+	if !ok {
+		v.AddError("start", "must be a time of day such as 07:30 or a timestamp")
+		return
+	}
+	exerciseMetric.StartedAt = &startedAt
+	if strings.TrimSpace(ended) != "" {
+		endedAt, clock, ok := parseTimeOn(startedAt, ended)
+		if !ok {
+			v.AddError("ended", "must be a time of day such as 08:15 or a timestamp")
+			return
+		}
+		if clock && !endedAt.After(startedAt) {
+			endedAt = endedAt.AddDate(0, 0, 1)
+		}
+		exerciseMetric.EndedAt = &endedAt
+	}
+	exerciseMetric.setDuration()
+}
+
+func ValidateExerciseMetric(v *validator.Validator, exerciseMetric *ExerciseMetric) {
+	v.Check(strings.TrimSpace(exerciseMetric.Name) != "", "name", "must be provided")
+	v.Check(len(exerciseMetric.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(validator.PermittedValue(exerciseMetric.Intensity, ExerciseIntensities...), "intensity", "must be one of "+strings.Join(ExerciseIntensities, ", "))
+	v.Check(exerciseMetric.NoOfTimes >= 0, "no_of_times", "must not be negative")
+	if exerciseMetric.StartedAt != nil && exerciseMetric.EndedAt != nil {
+		duration := exerciseMetric.EndedAt.Sub(*exerciseMetric.StartedAt)
+		v.Check(duration > 0, "ended", "must be after start")
+		v.Check(duration <= maxExercise, "ended", "must not be more than 24 hours after start")
+	}
+}
+
+// ExerciseMET() gives the metabolic equivalent of an exercise at an intensity.
+func ExerciseMET(name, intensity string) float64 {
+	name = strings.ToLower(name)
+	for _, activity := range activityMETs {
+		for _, keyword := range activity.keywords {
+			if strings.Contains(name, keyword) {
+				return activity.mets[intensity]
+			}
+		}
+	}
+	return intensityMETs[intensity]
+}
+
+// setDuration() derives the times of day, the duration and the MET of an exercise.
+func (e *ExerciseMetric) setDuration() {
+	e.MET = ExerciseMET(e.Name, e.Intensity)
+	if e.StartedAt != nil {
+		startedAt := e.StartedAt.UTC()
+		e.StartedAt = &startedAt
+		e.Started = startedAt.Format("15:04")
+	}
+	if e.EndedAt != nil {
+		endedAt := e.EndedAt.UTC()
+		e.EndedAt = &endedAt
+		e.Ended = endedAt.Format("15:04")
+	}
+	if e.StartedAt != nil && e.EndedAt != nil {
+		e.DurationMinutes = int(e.EndedAt.Sub(*e.StartedAt).Minutes())
+	}
+}
+
+// SetCalories() estimates the calories burnt by an exercise as its MET times the
+// weight in kg times the hours it lasted. It needs a weight and a duration.
+func (e *ExerciseMetric) SetCalories(weight int) {
+	e.Calories = nil
+	if weight <= 0 || e.DurationMinutes <= 0 {
+		return
+	}
+	calories := int(math.Round(e.MET * float64(weight) * float64(e.DurationMinutes) / 60))
+	e.Calories = &calories
 }
 
 type ExerciseMetricModel struct {
@@ -25,27 +156,36 @@ type ExerciseMetricModel struct {
 }
 
 func (m ExerciseMetricModel) InsertExerciseMetric(exerciseMetric *ExerciseMetric) error {
+	return insertExerciseMetric(m.DB, exerciseMetric)
+}
+
+func (m ExerciseMetricModel) InsertExerciseMetricTx(tx *sql.Tx, exerciseMetric *ExerciseMetric) error {
+	return insertExerciseMetric(tx, exerciseMetric)
+}
+
+// insertExerciseMetric() inserts every field, so it serves both a new entry, whose
+// times and tags are set later, and a complete imported one.
+func insertExerciseMetric(db execer, exerciseMetric *ExerciseMetric) error {
 	query := `
-        INSERT INTO user_exercise_metric (user_id, date, name)
-        VALUES ($1, $2, $3)
+        INSERT INTO user_exercise_metric (user_id, date, name, started_at, ended_at, intensity, tags, no_of_times)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
     `
+	tags := exerciseMetric.Tags
+	if tags == nil {
+		tags = []string{}
+	}
 	args := []any{
 		exerciseMetric.UserID,
-		exerciseMetric.Date, exerciseMetric.Name}
-
+		exerciseMetric.Date, exerciseMetric.Name, exerciseMetric.StartedAt, exerciseMetric.EndedAt, exerciseMetric.Intensity, pq.Array(tags), exerciseMetric.NoOfTimes}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
 }
 
 func (m ExerciseMetricModel) GetUserExerciseMetric(userId string, date time.Time) ([]*ExerciseMetric, error) {
 	query := `
-    SELECT uem.id, uem.name, uem.started, uem.ended, uem.tags, uem.date, uem.no_of_times
+    SELECT uem.id, uem.name, uem.started_at, uem.ended_at, uem.intensity, uem.tags, uem.date, uem.no_of_times
     FROM user_exercise_metric uem
     WHERE uem.user_id = $1 AND uem.date = $2
     `
@@ -60,10 +200,11 @@ func (m ExerciseMetricModel) GetUserExerciseMetric(userId string, date time.Time
 	exerciseMetrics := []*ExerciseMetric{}
 	for rows.Next() {
 		var exerciseMetric ExerciseMetric
-		err := rows.Scan(&exerciseMetric.ID, &exerciseMetric.Name, &exerciseMetric.Started, &exerciseMetric.Ended, pq.Array(&exerciseMetric.Tags), &exerciseMetric.Date, &exerciseMetric.NoOfTimes)
+		err := rows.Scan(&exerciseMetric.ID, &exerciseMetric.Name, &exerciseMetric.StartedAt, &exerciseMetric.EndedAt, &exerciseMetric.Intensity, pq.Array(&exerciseMetric.Tags), &exerciseMetric.Date, &exerciseMetric.NoOfTimes)
 		if err != nil {
 			return nil, err
 		}
+		exerciseMetric.setDuration()
 
 		exerciseMetrics = append(exerciseMetrics, &exerciseMetric)
 	}
@@ -75,9 +216,9 @@ func (m ExerciseMetricModel) GetUserExerciseMetric(userId string, date time.Time
 
 func (m ExerciseMetricModel) UpdateExerciseMetric(exerciseMetric *ExerciseMetric, id int) error {
 
-	query := ` UPDATE user_exercise_metric SET started = $1, ended = $2, tags = $3, no_of_times = $4 WHERE id = $5; `
+	query := ` UPDATE user_exercise_metric SET started_at = $1, ended_at = $2, intensity = $3, tags = $4, no_of_times = $5 WHERE id = $6; `
 
-	args := []any{&exerciseMetric.Started, &exerciseMetric.Ended, pq.Array(&exerciseMetric.Tags), &exerciseMetric.NoOfTimes, id}
+	args := []any{exerciseMetric.StartedAt, exerciseMetric.EndedAt, exerciseMetric.Intensity, pq.Array(&exerciseMetric.Tags), &exerciseMetric.NoOfTimes, id}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, args...)
@@ -97,7 +238,7 @@ func (m ExerciseMetricModel) Get(id int64) (*ExerciseMetric, error) {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-    SELECT uem.id, uem.name, uem.started, uem.ended, uem.tags, uem.date, uem.no_of_times
+    SELECT uem.id, uem.name, uem.started_at, uem.ended_at, uem.intensity, uem.tags, uem.date, uem.no_of_times
     FROM user_exercise_metric uem
     WHERE id = $1
     `
@@ -105,7 +246,7 @@ func (m ExerciseMetricModel) Get(id int64) (*ExerciseMetric, error) {
 	var exerciseMetric ExerciseMetric
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&exerciseMetric.ID, &exerciseMetric.Name, &exerciseMetric.Started, &exerciseMetric.Ended, pq.Array(&exerciseMetric.Tags), &exerciseMetric.Date, &exerciseMetric.NoOfTimes)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&exerciseMetric.ID, &exerciseMetric.Name, &exerciseMetric.StartedAt, &exerciseMetric.EndedAt, &exerciseMetric.Intensity, pq.Array(&exerciseMetric.Tags), &exerciseMetric.Date, &exerciseMetric.NoOfTimes)
 
 	if err != nil {
 		switch {
@@ -115,6 +256,7 @@ func (m ExerciseMetricModel) Get(id int64) (*ExerciseMetric, error) {
 			return nil, err
 		}
 	}
+	exerciseMetric.setDuration()
 	return &exerciseMetric, nil
 }
 
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// WeeklyActiveMinutesGoal is the least moderate-intensity activity a week the WHO
+// recommends for adults.
+const WeeklyActiveMinutesGoal = 150
+
+// ExerciseWeek totals the exercise of a week starting on Monday. As in the WHO
+// guidance, a vigorous minute counts as two moderate ones in ActiveMinutes and
+// light activity doesn't count.
+type ExerciseWeek struct {
+	WeekStart       time.Time `json:"week_start"`
+	LightMinutes    int       `json:"light_minutes"`
+	ModerateMinutes int       `json:"moderate_minutes"`
+	VigorousMinutes int       `json:"vigorous_minutes"`
+	ActiveMinutes   int       `json:"active_minutes"`
+	Calories        *int      `json:"calories"`
+	GoalMinutes     int       `json:"goal_minutes"`
+	GoalPercentage  float64   `json:"goal_percentage"`
+	GoalMet         bool      `json:"goal_met"`
+}
+
+// GetUserExerciseMetricsSince() returns the completed exercises of a user from a
+// date on.
+func (m ExerciseMetricModel) GetUserExerciseMetricsSince(userID string, since time.Time) ([]*ExerciseMetric, error) {
+	query := `
+    SELECT uem.id, uem.name, uem.started_at, uem.ended_at, uem.intensity, uem.tags, uem.date, uem.no_of_times
+    FROM user_exercise_metric uem
+    WHERE uem.user_id = $1 AND uem.date >= $2 AND uem.ended_at IS NOT NULL
+    ORDER BY uem.date, uem.started_at
+    `
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	exerciseMetrics := []*ExerciseMetric{}
+	for rows.Next() {
+		var exerciseMetric ExerciseMetric
+		err := rows.Scan(&exerciseMetric.ID, &exerciseMetric.Name, &exerciseMetric.StartedAt, &exerciseMetric.EndedAt, &exerciseMetric.Intensity, pq.Array(&exerciseMetric.Tags), &exerciseMetric.Date, &exerciseMetric.NoOfTimes)
+		if err != nil {
+			return nil, err
+		}
+		exerciseMetric.setDuration()
+		exerciseMetrics = append(exerciseMetrics, &exerciseMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return exerciseMetrics, nil
+}
+
+// ExerciseWeeks() totals the exercises of the given number of weeks from the Monday
+// from, by the date of each exercise. Calories are only totalled with a weight.
+func ExerciseWeeks(exerciseMetrics []*ExerciseMetric, from time.Time, weeks int, weight int) []ExerciseWeek {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	totals := make([]ExerciseWeek, weeks)
+	calories := make([]int, weeks)
+	for i := range totals {
+		totals[i] = ExerciseWeek{WeekStart: from.AddDate(0, 0, 7*i), GoalMinutes: WeeklyActiveMinutesGoal}
+	}
+	for _, exerciseMetric := range exerciseMetrics {
+		date := time.Date(exerciseMetric.Date.Year(), exerciseMetric.Date.Month(), exerciseMetric.Date.Day(), 0, 0, 0, 0, time.UTC)
+		if date.Before(from) {
+			continue
+		}
+		i := int(date.Sub(from).Hours()) / (24 * 7)
+		if i >= weeks {
+			continue
+		}
+		switch exerciseMetric.Intensity {
+		case IntensityLight:
+			totals[i].LightMinutes += exerciseMetric.DurationMinutes
+		case IntensityModerate:
+			totals[i].ModerateMinutes += exerciseMetric.DurationMinutes
+		case IntensityVigorous:
+			totals[i].VigorousMinutes += exerciseMetric.DurationMinutes
+		}
+		exerciseMetric.SetCalories(weight)
+		if exerciseMetric.Calories != nil {
+			calories[i] += *exerciseMetric.Calories
+		}
+	}
+	for i := range totals {
+		week := &totals[i]
+		week.ActiveMinutes = week.ModerateMinutes + 2*week.VigorousMinutes
+		week.GoalPercentage = Round(math.Min(100, float64(week.ActiveMinutes)*100/WeeklyActiveMinutesGoal))
+		week.GoalMet = week.ActiveMinutes >= WeeklyActiveMinutesGoal
+		if weight > 0 {
+			week.Calories = &calories[i]
+		}
+	}
+	return totals
+}
@@ -9,6 +9,11 @@ import (
 	"github.com/lib/pq"
 )
 
+// glassVolume is the volume in ml of a glass of water logged with food.
+const glassVolume = 250
+
+// FoodMetric is what a user ate on a day. GlassNo is only kept for entries from
+// before drinks were logged as hydration metrics, which they were copied to.
 type FoodMetric struct {
 	ID             int       `json:"id"`
 	UserID         string    `json:"user_id"`
@@ -30,6 +35,24 @@ type FoodMetric struct {
 	GlassNo        int       `json:"glass_no"`
 }
 
+// GlassesAsHydration() returns the glasses of water of an entry as one drink at
+// noon, the way they were copied when hydration metrics were added, or nil when
+// there are none.
+func (f *FoodMetric) GlassesAsHydration() *HydrationMetric {
+	if f.GlassNo <= 0 {
+		return nil
+	}
+	date := TruncateToDay(f.Date)
+	hydrationMetric := &HydrationMetric{
+		Date:     date,
+		DrunkAt:  date.Add(12 * time.Hour),
+		VolumeML: f.GlassNo * glassVolume,
+		Beverage: BeverageWater,
+	}
+	hydrationMetric.setTime()
+	return hydrationMetric
+}
+
 type FoodMetricModel struct {
 	DB *sql.DB
 }
@@ -73,6 +96,14 @@ func (m FoodMetricModel) GetUserFoodMetric(userId string, date time.Time) (*Food
 }
 
 func (m FoodMetricModel) InsertFoodMetric(foodMetric *FoodMetric) error {
+	return insertFoodMetric(m.DB, foodMetric)
+}
+
+func (m FoodMetricModel) InsertFoodMetricTx(tx *sql.Tx, foodMetric *FoodMetric) error {
+	return insertFoodMetric(tx, foodMetric)
+}
+
+func insertFoodMetric(db execer, foodMetric *FoodMetric) error {
 	query := `
         INSERT INTO user_food_metric (user_id, date, breakfast_meal, lunch_meal, dinner_meal, 
                                        breakfast_extra, lunch_extra, dinner_extra, 
@@ -81,7 +112,7 @@ func (m FoodMetricModel) InsertFoodMetric(foodMetric *FoodMetric) error {
                                        snack_name, snack_tags, glass_no)
         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
     `
-	args := []interface{}{
+	args := []any{
 		foodMetric.UserID,
 		foodMetric.Date,
 		foodMetric.BreakfastMeal,
@@ -100,16 +131,12 @@ func (m FoodMetricModel) InsertFoodMetric(foodMetric *FoodMetric) error {
 		pq.Array(foodMetric.SnackTags),
 		foodMetric.GlassNo,
 	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
 }
+
 func (m FoodMetricModel) UpdateFoodMetric(foodMetric *FoodMetric) error {
 	query := `
         UPDATE user_food_metric
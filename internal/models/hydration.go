@@ -0,0 +1,217 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/olagookundavid/itoju/internal/validator"
+)
+
+const (
+	BeverageWater   = "water"
+	BeverageTea     = "tea"
+	BeverageCoffee  = "coffee"
+	BeverageAlcohol = "alcohol"
+)
+
+var Beverages = []string{BeverageWater, BeverageTea, BeverageCoffee, BeverageAlcohol}
+
+const (
+	// hydrationMLPerKg is the daily intake recommended per kg of body weight.
+	hydrationMLPerKg = 35
+	// defaultHydrationGoal is the daily goal of users who haven't saved their weight.
+	defaultHydrationGoal = 2000
+	// maxDrinkVolume is the largest volume a single entry may have.
+	maxDrinkVolume = 5000
+)
+
+// HydrationMetric is a drink. Time is the time of day of DrunkAt.
+type HydrationMetric struct {
+	ID       int64     `json:"id"`
+	Date     time.Time `json:"date"`
+	Time     string    `json:"time"`
+	DrunkAt  time.Time `json:"drunk_at"`
+	VolumeML int       `json:"volume_ml"`
+	Beverage string    `json:"beverage"`
+}
+
+// HydrationDay totals the drinks of a day. Alcohol dehydrates rather than
+// hydrates, so it doesn't count towards IntakeML and the goal.
+type HydrationDay struct {
+	Date           time.Time      `json:"date"`
+	IntakeML       int            `json:"intake_ml"`
+	AlcoholML      int            `json:"alcohol_ml"`
+	ByBeverage     map[string]int `json:"by_beverage"`
+	GoalML         int            `json:"goal_ml"`
+	GoalPercentage float64        `json:"goal_percentage"`
+	GoalMet        bool           `json:"goal_met"`
+}
+
+// HydrationGoal() gives the daily intake goal in ml for a weight in kg.
+func HydrationGoal(weight int) int {
+	if weight <= 0 {
+		return defaultHydrationGoal
+	}
+	return weight * hydrationMLPerKg
+}
+
+// ReadHydrationTime() sets DrunkAt from a time of day on the date of the entry, or
+// a full timestamp.
+func ReadHydrationTime(v *validator.Validator, hydrationMetric *HydrationMetric, value string) {
+	drunkAt, _, ok := parseTimeOn(hydrationMetric.Date, value)
+	if !ok {
+		v.AddError("time", "must be a time of day such as 09:30 or a timestamp")
+		return
+	}
+	hydrationMetric.DrunkAt = drunkAt
+	hydrationMetric.setTime()
+}
+
+func ValidateHydrationMetric(v *validator.Validator, hydrationMetric *HydrationMetric) {
+	v.Check(!hydrationMetric.DrunkAt.IsZero(), "time", "must be provided")
+	v.Check(hydrationMetric.VolumeML > 0, "volume_ml", "must be greater than zero")
+	v.Check(hydrationMetric.VolumeML <= maxDrinkVolume, "volume_ml", "must not be more than 5000")
+	v.Check(validator.PermittedValue(hydrationMetric.Beverage, Beverages...), "beverage", "must be one of "+strings.Join(Beverages, ", "))
+}
+
+// SummarizeHydration() totals the drinks of a day against a goal.
+func SummarizeHydration(date time.Time, hydrationMetrics []*HydrationMetric, goal int) HydrationDay {
+	day := HydrationDay{Date: date, ByBeverage: make(map[string]int), GoalML: goal}
+	for _, beverage := range Beverages {
+		day.ByBeverage[beverage] = 0
+	}
+	for _, hydrationMetric := range hydrationMetrics {
+		day.ByBeverage[hydrationMetric.Beverage] += hydrationMetric.VolumeML
+		if hydrationMetric.Beverage == BeverageAlcohol {
+			day.AlcoholML += hydrationMetric.VolumeML
+			continue
+		}
+		day.IntakeML += hydrationMetric.VolumeML
+	}
+	day.GoalPercentage = Round(math.Min(100, float64(day.IntakeML)*100/float64(goal)))
+	day.GoalMet = day.IntakeML >= goal
+	return day
+}
+
+type HydrationMetricModel struct {
+	DB *sql.DB
+}
+
+func (m HydrationMetricModel) GetUserHydrationMetrics(userID string, date time.Time) ([]*HydrationMetric, error) {
+	query := `
+	SELECT id, date, drunk_at, volume_ml, beverage
+	FROM user_hydration_metric
+	WHERE user_id = $1 AND date = $2
+	ORDER BY drunk_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hydrationMetrics := []*HydrationMetric{}
+	for rows.Next() {
+		var hydrationMetric HydrationMetric
+		err := rows.Scan(&hydrationMetric.ID, &hydrationMetric.Date, &hydrationMetric.DrunkAt, &hydrationMetric.VolumeML, &hydrationMetric.Beverage)
+		if err != nil {
+			return nil, err
+		}
+		hydrationMetric.setTime()
+		hydrationMetrics = append(hydrationMetrics, &hydrationMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return hydrationMetrics, nil
+}
+
+func (m HydrationMetricModel) GetUserHydrationMetric(userID string, id int64) (*HydrationMetric, error) {
+	query := `
+	SELECT id, date, drunk_at, volume_ml, beverage
+	FROM user_hydration_metric
+	WHERE user_id = $1 AND id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var hydrationMetric HydrationMetric
+	err := m.DB.QueryRowContext(ctx, query, userID, id).Scan(&hydrationMetric.ID, &hydrationMetric.Date, &hydrationMetric.DrunkAt, &hydrationMetric.VolumeML, &hydrationMetric.Beverage)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	hydrationMetric.setTime()
+	return &hydrationMetric, nil
+}
+
+func (m HydrationMetricModel) InsertHydrationMetric(userID string, hydrationMetric *HydrationMetric) error {
+	return insertHydrationMetric(m.DB, userID, hydrationMetric)
+}
+
+func (m HydrationMetricModel) InsertHydrationMetricTx(tx *sql.Tx, userID string, hydrationMetric *HydrationMetric) error {
+	return insertHydrationMetric(tx, userID, hydrationMetric)
+}
+
+func insertHydrationMetric(db execer, userID string, hydrationMetric *HydrationMetric) error {
+	query := `
+	INSERT INTO user_hydration_metric (user_id, date, drunk_at, volume_ml, beverage)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	args := []any{userID, hydrationMetric.Date, hydrationMetric.DrunkAt, hydrationMetric.VolumeML, hydrationMetric.Beverage}
+	return db.QueryRowContext(ctx, query, args...).Scan(&hydrationMetric.ID)
+}
+
+func (m HydrationMetricModel) UpdateHydrationMetric(userID string, hydrationMetric *HydrationMetric) error {
+	query := ` UPDATE user_hydration_metric SET drunk_at = $1, volume_ml = $2, beverage = $3 WHERE id = $4 AND user_id = $5`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	args := []any{hydrationMetric.DrunkAt, hydrationMetric.VolumeML, hydrationMetric.Beverage, hydrationMetric.ID, userID}
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	return nil
+}
+
+func (m HydrationMetricModel) DeleteHydrationMetric(id int64, userID string) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := ` DELETE FROM user_hydration_metric WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// setTime() derives the time of day of a drink, normalising DrunkAt to UTC.
+func (h *HydrationMetric) setTime() {
+	h.DrunkAt = h.DrunkAt.UTC()
+	h.Time = h.DrunkAt.Format("15:04")
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HydrationSummary totals the drinks and urination of a period so the two can be
+// compared. Averages are per day with an entry of their kind.
+type HydrationSummary struct {
+	IntakeML               int     `json:"intake_ml"`
+	AlcoholML              int     `json:"alcohol_ml"`
+	DaysLogged             int     `json:"days_logged"`
+	AverageDailyML         int     `json:"average_daily_ml"`
+	GoalML                 int     `json:"goal_ml"`
+	GoalDays               int     `json:"goal_days"`
+	Urinations             int     `json:"urinations"`
+	AverageDailyUrinations float64 `json:"average_daily_urinations"`
+	AverageUrineQuantity   float64 `json:"average_urine_quantity"`
+}
+
+// hydrationSummaryQuery joins the daily drinks and urine entries of a user, then
+// sums them per period, given as an expression of the date. $2 is the daily goal.
+const hydrationSummaryQuery = `
+	WITH intake AS (
+		SELECT
+			date,
+			COALESCE(SUM(volume_ml) FILTER (WHERE beverage <> 'alcohol'), 0) AS intake_ml,
+			COALESCE(SUM(volume_ml) FILTER (WHERE beverage = 'alcohol'), 0) AS alcohol_ml
+		FROM
+			user_hydration_metric
+		WHERE
+			user_id = $1
+			AND %[2]s
+		GROUP BY
+			date
+	), urine AS (
+		SELECT
+			date,
+			COUNT(*) AS urinations,
+			AVG(quantity) AS quantity
+		FROM
+			user_urine_metric
+		WHERE
+			user_id = $1
+			AND %[2]s
+		GROUP BY
+			date
+	), days AS (
+		SELECT
+			COALESCE(i.date, u.date) AS date,
+			i.date IS NOT NULL AS logged,
+			COALESCE(i.intake_ml, 0) AS intake_ml,
+			COALESCE(i.alcohol_ml, 0) AS alcohol_ml,
+			COALESCE(u.urinations, 0) AS urinations,
+			u.quantity
+		FROM
+			intake i
+			FULL JOIN urine u ON u.date = i.date
+	)
+	SELECT
+		%[1]s AS period,
+		SUM(intake_ml),
+		SUM(alcohol_ml),
+		COUNT(*) FILTER (WHERE logged),
+		COUNT(*) FILTER (WHERE logged AND intake_ml >= $2),
+		SUM(urinations),
+		COUNT(*) FILTER (WHERE urinations > 0),
+		COALESCE(AVG(quantity), 0)
+	FROM
+		days
+	GROUP BY
+		period
+	ORDER BY
+		period;
+`
+
+// GetHydrationDaysSummaries sums the drinks and urination of the last days per day
+// of the week.
+func (m AnalyticsModel) GetHydrationDaysSummaries(userID string, days int, goal int) (map[int]HydrationSummary, error) {
+	query := fmt.Sprintf(hydrationSummaryQuery, "EXTRACT(DOW FROM date)",
+		fmt.Sprintf("date >= CURRENT_DATE - INTERVAL '%d days'", days))
+	return m.getHydrationSummaries(query, []any{userID, goal}, goal, 0, 6)
+}
+
+// GetMonthHydrationSummaries sums the drinks and urination of a month per week of
+// the month.
+func (m AnalyticsModel) GetMonthHydrationSummaries(userID string, month int, goal int) (map[int]HydrationSummary, error) {
+	query := fmt.Sprintf(hydrationSummaryQuery, "(EXTRACT(WEEK FROM date) - EXTRACT(WEEK FROM date_trunc('month', date)) + 1)",
+		"EXTRACT(MONTH FROM date) = $3")
+	return m.getHydrationSummaries(query, []any{userID, goal, month}, goal, 1, 5)
+}
+
+// GetYearHydrationSummaries sums the drinks and urination of a year per month.
+func (m AnalyticsModel) GetYearHydrationSummaries(userID string, year int, goal int) (map[int]HydrationSummary, error) {
+	query := fmt.Sprintf(hydrationSummaryQuery, "EXTRACT(MONTH FROM date)", "EXTRACT(YEAR FROM date) = $3")
+	return m.getHydrationSummaries(query, []any{userID, goal, year}, goal, 1, 12)
+}
+
+// getHydrationSummaries runs a hydrationSummaryQuery, giving every period from first
+// to last a summary, empty when nothing was logged.
+func (m AnalyticsModel) getHydrationSummaries(query string, args []any, goal int, first, last int) (map[int]HydrationSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	summaries := make(map[int]HydrationSummary)
+	for rows.Next() {
+		var period, urineDays int
+		summary := HydrationSummary{GoalML: goal}
+		err := rows.Scan(&period, &summary.IntakeML, &summary.AlcoholML, &summary.DaysLogged, &summary.GoalDays,
+			&summary.Urinations, &urineDays, &summary.AverageUrineQuantity)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		if summary.DaysLogged > 0 {
+			summary.AverageDailyML = summary.IntakeML / summary.DaysLogged
+		}
+		if urineDays > 0 {
+			summary.AverageDailyUrinations = Round(float64(summary.Urinations) / float64(urineDays))
+		}
+		summary.AverageUrineQuantity = Round(summary.AverageUrineQuantity)
+		summaries[period] = summary
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := first; i <= last; i++ {
+		if _, exists := summaries[i]; !exists {
+			summaries[i] = HydrationSummary{GoalML: goal}
+		}
+	}
+
+	return summaries, nil
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginFailures counts the failed logins for an account and for an ip address since
+// a point in time. Failures before the last successful login of the account are
+// not counted against it.
+type LoginFailures struct {
+	Account            int
+	IP                 int
+	LastAccountFailure time.Time
+	LastIPFailure      time.Time
+}
+
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+func (m LoginAttemptModel) Insert(email, ip string, succeeded bool) error {
+	query := ` INSERT INTO login_attempts (email, ip, succeeded) VALUES ($1, $2, $3)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, email, ip, succeeded)
+	return err
+}
+
+func (m LoginAttemptModel) GetFailures(email, ip string, since time.Time) (*LoginFailures, error) {
+	query := `
+	WITH last_success AS (
+		SELECT COALESCE(MAX(attempted_at), $3) AS at
+		FROM login_attempts
+		WHERE email = $1 AND succeeded
+	)
+	SELECT
+		COUNT(*) FILTER (WHERE email = $1 AND attempted_at > GREATEST($3, (SELECT at FROM last_success))),
+		COUNT(*) FILTER (WHERE ip = $2),
+		COALESCE(MAX(attempted_at) FILTER (WHERE email = $1), $3),
+		COALESCE(MAX(attempted_at) FILTER (WHERE ip = $2), $3)
+	FROM login_attempts
+	WHERE (email = $1 OR ip = $2) AND NOT succeeded AND attempted_at > $3`
+
+	var failures LoginFailures
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, email, ip, since).Scan(
+		&failures.Account,
+		&failures.IP,
+		&failures.LastAccountFailure,
+		&failures.LastIPFailure)
+	if err != nil {
+		return nil, err
+	}
+	return &failures, nil
+}
+
+// ClearFailures() forgets the failed logins of an account, e.g. once it is unlocked.
+func (m LoginAttemptModel) ClearFailures(email string) error {
+	query := ` DELETE FROM login_attempts WHERE email = $1 AND NOT succeeded`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, email)
+	return err
+}
+
+func (m LoginAttemptModel) DeleteOlderThan(before time.Time) error {
+	query := ` DELETE FROM login_attempts WHERE attempted_at < $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, before)
+	return err
+}
+
+func (m LoginAttemptModel) Lock(userID string, until time.Time) error {
+	query := `
+	INSERT INTO account_lockouts (user_id, locked_until)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id)
+	DO UPDATE SET locked_until = EXCLUDED.locked_until, created_at = NOW()`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, until)
+	return err
+}
+
+// GetLock() returns until when a user is locked out, or ErrRecordNotFound if the
+// user is not locked.
+func (m LoginAttemptModel) GetLock(userID string) (time.Time, error) {
+	query := ` SELECT locked_until FROM account_lockouts WHERE user_id = $1 AND locked_until > NOW()`
+	var lockedUntil time.Time
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&lockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, ErrRecordNotFound
+		default:
+			return time.Time{}, err
+		}
+	}
+	return lockedUntil, nil
+}
+
+func (m LoginAttemptModel) Unlock(userID string) error {
+	query := ` DELETE FROM account_lockouts WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
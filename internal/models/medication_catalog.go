@@ -0,0 +1,246 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/olagookundavid/itoju/internal/validator"
+)
+
+var (
+	MedicationForms = []string{"tablet", "capsule", "liquid", "injection", "patch", "gel", "cream", "inhaler",
+		"drops", "suppository", "pessary", "powder", "ring", "spray", "implant"}
+	MedicationUnits = []string{"mg", "mcg", "g", "ml", "IU", "units", "drops", "puffs", "tablet", "capsule",
+		"patch", "sachet"}
+)
+
+// maxDosage is the largest dosage a NUMERIC(8,2) column holds.
+const maxDosage = 999999.99
+
+// Medication is an entry of the catalog, or a custom medication a user saved.
+type Medication struct {
+	ID     int64    `json:"id"`
+	UserID string   `json:"-"`
+	Name   string   `json:"name"`
+	Forms  []string `json:"forms"`
+	Units  []string `json:"units"`
+	Custom bool     `json:"custom"`
+}
+
+func ValidateMedication(v *validator.Validator, medication *Medication) {
+	v.Check(strings.TrimSpace(medication.Name) != "", "name", "must be provided")
+	v.Check(len(medication.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(medication.Forms) > 0, "forms", "must contain at least one form")
+	v.Check(validator.Unique(medication.Forms), "forms", "must not contain duplicate values")
+	for _, form := range medication.Forms {
+		if !validator.PermittedValue(form, MedicationForms...) {
+			v.AddError("forms", "must only contain "+strings.Join(MedicationForms, ", "))
+			break
+		}
+	}
+	v.Check(len(medication.Units) > 0, "units", "must contain at least one unit")
+	v.Check(validator.Unique(medication.Units), "units", "must not contain duplicate values")
+	for _, unit := range medication.Units {
+		if !validator.PermittedValue(unit, MedicationUnits...) {
+			v.AddError("units", "must only contain "+strings.Join(MedicationUnits, ", "))
+			break
+		}
+	}
+}
+
+func ValidateDosage(v *validator.Validator, dosage float64, key string) {
+	v.Check(dosage > 0, key, "must be greater than zero")
+	v.Check(dosage <= maxDosage, key, "must not be more than 999999.99")
+}
+
+// ValidateQuantity() checks a quantity fits the column, which holds the same range as
+// dosage. No quantity at all is allowed.
+func ValidateQuantity(v *validator.Validator, quantity float64, key string) {
+	v.Check(quantity >= 0, key, "must not be negative")
+	v.Check(quantity <= maxDosage, key, "must not be more than 999999.99")
+}
+
+// NormalizeMedicationUnit() returns unit spelled the way the medication, or the list
+// of known units when medication is nil, spells it, so "MG" becomes "mg". A unit
+// that isn't known is returned as is for validation to reject.
+func NormalizeMedicationUnit(medication *Medication, unit string) string {
+	units := MedicationUnits
+	if medication != nil {
+		units = medication.Units
+	}
+	for _, known := range units {
+		if strings.EqualFold(known, strings.TrimSpace(unit)) {
+			return known
+		}
+	}
+	return unit
+}
+
+// ValidateMedicationUnit() checks the unit a medication is dosed in: one the
+// medication comes in when it is known, and any known unit otherwise.
+func ValidateMedicationUnit(v *validator.Validator, medication *Medication, unit, key string) {
+	if medication != nil {
+		v.Check(validator.PermittedValue(unit, medication.Units...), key, medication.Name+" is dosed in "+strings.Join(medication.Units, ", "))
+		return
+	}
+	v.Check(validator.PermittedValue(unit, MedicationUnits...), key, "must be one of "+strings.Join(MedicationUnits, ", "))
+}
+
+type MedicationModel struct {
+	DB *sql.DB
+}
+
+// Search() lists the catalog and custom medications of a user whose name contains
+// q, names starting with q first.
+func (m MedicationModel) Search(userID, q string, limit int) ([]*Medication, error) {
+	query := `
+	SELECT id, name, forms, units, user_id IS NOT NULL
+	FROM medications
+	WHERE (user_id IS NULL OR user_id = $1)
+	AND ($2 = '' OR name ILIKE '%' || $2 || '%')
+	ORDER BY (name ILIKE $2 || '%') DESC, lower(name)
+	LIMIT $3`
+	// Wildcards typed by the user are searched for literally.
+	q = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.TrimSpace(q))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	medications := []*Medication{}
+	for rows.Next() {
+		var medication Medication
+		err := rows.Scan(&medication.ID, &medication.Name, pq.Array(&medication.Forms), pq.Array(&medication.Units), &medication.Custom)
+		if err != nil {
+			return nil, err
+		}
+		medications = append(medications, &medication)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return medications, nil
+}
+
+// Get() returns a catalog medication or a custom medication of the user.
+func (m MedicationModel) Get(id int64, userID string) (*Medication, error) {
+	query := `
+	SELECT id, name, forms, units, user_id IS NOT NULL
+	FROM medications
+	WHERE id = $1 AND (user_id IS NULL OR user_id = $2)`
+	return m.getOne(query, id, userID)
+}
+
+// GetByName() looks a medication up by name, ignoring case. A custom medication of
+// the user wins over a catalog one with the same name.
+func (m MedicationModel) GetByName(name, userID string) (*Medication, error) {
+	query := `
+	SELECT id, name, forms, units, user_id IS NOT NULL
+	FROM medications
+	WHERE lower(name) = lower($1) AND (user_id IS NULL OR user_id = $2)
+	ORDER BY user_id NULLS LAST
+	LIMIT 1`
+	return m.getOne(query, strings.TrimSpace(name), userID)
+}
+
+func (m MedicationModel) getOne(query string, args ...any) (*Medication, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var medication Medication
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&medication.ID, &medication.Name,
+		pq.Array(&medication.Forms), pq.Array(&medication.Units), &medication.Custom)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &medication, nil
+}
+
+// GetCustom() lists the custom medications a user saved.
+func (m MedicationModel) GetCustom(userID string) ([]*Medication, error) {
+	query := `
+	SELECT id, name, forms, units, true
+	FROM medications
+	WHERE user_id = $1
+	ORDER BY lower(name)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	medications := []*Medication{}
+	for rows.Next() {
+		var medication Medication
+		err := rows.Scan(&medication.ID, &medication.Name, pq.Array(&medication.Forms), pq.Array(&medication.Units), &medication.Custom)
+		if err != nil {
+			return nil, err
+		}
+		medications = append(medications, &medication)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return medications, nil
+}
+
+// InsertCustom() saves a custom medication for a user.
+func (m MedicationModel) InsertCustom(medication *Medication) error {
+	return insertCustomMedication(m.DB, medication)
+}
+
+func (m MedicationModel) InsertCustomTx(tx *sql.Tx, medication *Medication) error {
+	return insertCustomMedication(tx, medication)
+}
+
+func insertCustomMedication(db execer, medication *Medication) error {
+	query := `
+	INSERT INTO medications (name, forms, units, user_id)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	medication.Name = strings.TrimSpace(medication.Name)
+	medication.Custom = true
+	err := db.QueryRowContext(ctx, query, medication.Name, pq.Array(medication.Forms), pq.Array(medication.Units), medication.UserID).Scan(&medication.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "medications_user_id_name_key"`:
+			return ErrRecordAlreadyExist
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteCustom() deletes a custom medication of a user. Catalog medications can't
+// be deleted.
+func (m MedicationModel) DeleteCustom(id int64, userID string) error {
+	query := ` DELETE FROM medications WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
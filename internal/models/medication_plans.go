@@ -0,0 +1,434 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/olagookundavid/itoju/internal/rrule"
+	"github.com/olagookundavid/itoju/internal/validator"
+)
+
+// Statuses of a dose. Only taken and skipped are recorded; a past dose without a
+// record was missed and a future one is upcoming.
+const (
+	DoseTaken    = "taken"
+	DoseSkipped  = "skipped"
+	DoseMissed   = "missed"
+	DoseUpcoming = "upcoming"
+)
+
+// doseTimeLayout is the layout of the times of day in a plan.
+const doseTimeLayout = "15:04"
+
+type MedicationPlan struct {
+	ID        int64      `json:"id"`
+	UserID    string     `json:"-"`
+	Name      string     `json:"name"`
+	Dose      float64    `json:"dose"`
+	Unit      string     `json:"unit"`
+	Frequency string     `json:"frequency"`
+	Times     []string   `json:"times"`
+	StartDate time.Time  `json:"start_date"`
+	EndDate   *time.Time `json:"end_date"`
+	Reminders bool       `json:"reminders"`
+	CreatedAt time.Time  `json:"created_at"`
+	Version   int        `json:"version"`
+}
+
+// Dose is one expected dose of a plan. ScheduledAt has no time zone: it is the
+// date and clock time the user takes the medication at, wherever they are.
+type Dose struct {
+	PlanID      int64      `json:"plan_id"`
+	Name        string     `json:"name"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	Status      string     `json:"status"`
+	MetricID    *int       `json:"metric_id"`
+	RecordedAt  *time.Time `json:"recorded_at,omitempty"`
+}
+
+type Adherence struct {
+	PlanID  int64  `json:"plan_id"`
+	Name    string `json:"name"`
+	Due     int    `json:"due"`
+	Taken   int    `json:"taken"`
+	Skipped int    `json:"skipped"`
+	Missed  int    `json:"missed"`
+	// Percentage is the share of due doses that were taken, or nil when no dose
+	// was due.
+	Percentage *float64 `json:"percentage"`
+}
+
+func ValidateMedicationPlan(v *validator.Validator, plan *MedicationPlan) {
+	v.Check(plan.Name != "", "name", "must be provided")
+	v.Check(len(plan.Name) <= 100, "name", "must not be more than 100 bytes long")
+	ValidateDosage(v, plan.Dose, "dose")
+	_, err := rrule.Parse(plan.Frequency)
+	if err != nil {
+		v.AddError("frequency", err.Error())
+	}
+	v.Check(len(plan.Times) > 0, "times", "must contain at least one time")
+	v.Check(len(plan.Times) <= 12, "times", "must not contain more than 12 times")
+	v.Check(validator.Unique(plan.Times), "times", "must not contain duplicate values")
+	for _, t := range plan.Times {
+		if _, err := time.Parse(doseTimeLayout, t); err != nil {
+			v.AddError("times", "must be times of day as HH:MM")
+			break
+		}
+	}
+	if plan.EndDate != nil {
+		v.Check(!plan.EndDate.Before(plan.StartDate), "end_date", "must not be before the start date")
+	}
+}
+
+// ExpectedDoses() returns the times a dose is due between from and to, inclusive.
+// The frequency must have been validated.
+func (p *MedicationPlan) ExpectedDoses(from, to time.Time) []time.Time {
+	rule, err := rrule.Parse(p.Frequency)
+	if err != nil {
+		return nil
+	}
+	if p.EndDate != nil && (rule.Until.IsZero() || p.EndDate.Before(rule.Until)) {
+		rule.Until = *p.EndDate
+	}
+	times := slices.Clone(p.Times)
+	slices.Sort(times)
+	var doses []time.Time
+	for _, date := range rule.Between(p.StartDate, from, to) {
+		for _, t := range times {
+			clock, err := time.Parse(doseTimeLayout, t)
+			if err != nil {
+				continue
+			}
+			at := date.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute)
+			if !at.Before(from) && !at.After(to) {
+				doses = append(doses, at)
+			}
+		}
+	}
+	return doses
+}
+
+// Expects() reports whether a dose of the plan is due at exactly at.
+func (p *MedicationPlan) Expects(at time.Time) bool {
+	return len(p.ExpectedDoses(at, at)) == 1
+}
+
+// BuildDoses() lists the expected doses of a plan between from and to with the
+// status recorded for each, counting unrecorded doses before now as missed.
+func BuildDoses(plan *MedicationPlan, recorded []Dose, from, to, now time.Time) []Dose {
+	byTime := map[int64]Dose{}
+	for _, dose := range recorded {
+		if dose.PlanID == plan.ID {
+			byTime[dose.ScheduledAt.Unix()] = dose
+		}
+	}
+	doses := []Dose{}
+	for _, at := range plan.ExpectedDoses(from, to) {
+		dose, ok := byTime[at.Unix()]
+		if !ok {
+			dose = Dose{PlanID: plan.ID, ScheduledAt: at, Status: DoseUpcoming}
+			if at.Before(now) {
+				dose.Status = DoseMissed
+			}
+		}
+		dose.Name = plan.Name
+		doses = append(doses, dose)
+	}
+	return doses
+}
+
+// ComputeAdherence() counts the doses that were due, leaving out upcoming ones.
+func ComputeAdherence(plan *MedicationPlan, doses []Dose) Adherence {
+	adherence := Adherence{PlanID: plan.ID, Name: plan.Name}
+	for _, dose := range doses {
+		switch dose.Status {
+		case DoseTaken:
+			adherence.Taken++
+		case DoseSkipped:
+			adherence.Skipped++
+		case DoseMissed:
+			adherence.Missed++
+		default:
+			continue
+		}
+		adherence.Due++
+	}
+	if adherence.Due > 0 {
+		percentage := Round(float64(adherence.Taken) / float64(adherence.Due) * 100)
+		adherence.Percentage = &percentage
+	}
+	return adherence
+}
+
+type MedicationPlanModel struct {
+	DB *sql.DB
+}
+
+func (m MedicationPlanModel) Insert(plan *MedicationPlan) error {
+	return insertMedicationPlan(m.DB, plan)
+}
+
+func (m MedicationPlanModel) InsertTx(tx *sql.Tx, plan *MedicationPlan) error {
+	return insertMedicationPlan(tx, plan)
+}
+
+func insertMedicationPlan(db execer, plan *MedicationPlan) error {
+	query := `
+	INSERT INTO medication_plans (user_id, name, dose, unit, frequency, times, start_date, end_date, reminders)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id, created_at, version`
+	args := []any{plan.UserID, plan.Name, plan.Dose, plan.Unit, plan.Frequency, pq.Array(plan.Times), plan.StartDate, plan.EndDate, plan.Reminders}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return db.QueryRowContext(ctx, query, args...).Scan(&plan.ID, &plan.CreatedAt, &plan.Version)
+}
+
+func (m MedicationPlanModel) Get(id int64, userID string) (*MedicationPlan, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, user_id, name, dose, unit, frequency, times, start_date, end_date, reminders, created_at, version
+	FROM medication_plans
+	WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var plan MedicationPlan
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&plan.ID, &plan.UserID, &plan.Name, &plan.Dose, &plan.Unit,
+		&plan.Frequency, pq.Array(&plan.Times), &plan.StartDate, &plan.EndDate, &plan.Reminders, &plan.CreatedAt, &plan.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &plan, nil
+}
+
+func (m MedicationPlanModel) GetAll(userID string) ([]*MedicationPlan, error) {
+	query := `
+	SELECT id, user_id, name, dose, unit, frequency, times, start_date, end_date, reminders, created_at, version
+	FROM medication_plans
+	WHERE user_id = $1
+	ORDER BY start_date, id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	plans := []*MedicationPlan{}
+	for rows.Next() {
+		var plan MedicationPlan
+		err := rows.Scan(&plan.ID, &plan.UserID, &plan.Name, &plan.Dose, &plan.Unit, &plan.Frequency,
+			pq.Array(&plan.Times), &plan.StartDate, &plan.EndDate, &plan.Reminders, &plan.CreatedAt, &plan.Version)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, &plan)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+func (m MedicationPlanModel) Update(plan *MedicationPlan) error {
+	query := `
+	UPDATE medication_plans SET name = $1, dose = $2, unit = $3, frequency = $4, times = $5, start_date = $6,
+	end_date = $7, reminders = $8, version = version + 1
+	WHERE id = $9 AND user_id = $10 AND version = $11
+	RETURNING version`
+	args := []any{plan.Name, plan.Dose, plan.Unit, plan.Frequency, pq.Array(plan.Times), plan.StartDate,
+		plan.EndDate, plan.Reminders, plan.ID, plan.UserID, plan.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&plan.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MedicationPlanModel) Delete(id int64, userID string) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := ` DELETE FROM medication_plans WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetDoses() returns the recorded doses of a user between from and to, for one plan
+// or, when planID is 0, for all of them.
+func (m MedicationPlanModel) GetDoses(userID string, planID int64, from, to time.Time) ([]Dose, error) {
+	query := `
+	SELECT plan_id, scheduled_at, status, metric_id, recorded_at
+	FROM medication_doses
+	WHERE user_id = $1 AND ($2::BIGINT = 0 OR plan_id = $2) AND scheduled_at BETWEEN $3 AND $4
+	ORDER BY scheduled_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, planID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	doses := []Dose{}
+	for rows.Next() {
+		var dose Dose
+		err := rows.Scan(&dose.PlanID, &dose.ScheduledAt, &dose.Status, &dose.MetricID, &dose.RecordedAt)
+		if err != nil {
+			return nil, err
+		}
+		dose.ScheduledAt = dose.ScheduledAt.UTC()
+		doses = append(doses, dose)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return doses, nil
+}
+
+// RecordDose() records a dose as taken or skipped, replacing an earlier answer. When
+// metric is not nil it is logged and the dose linked to it, unless the dose is
+// already linked to a medication metric, which is then kept. It reports whether
+// metric was logged, so sending the same answer twice logs the medication once. A
+// skipped dose is linked to no metric: one it was logged as when taken is kept,
+// like when the answer is deleted, since it may have been edited since.
+func (m MedicationPlanModel) RecordDose(userID string, dose *Dose, metric *MedicationMetric) (bool, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var linked *int
+	err = tx.QueryRowContext(ctx, ` SELECT metric_id FROM medication_doses WHERE plan_id = $1 AND scheduled_at = $2 FOR UPDATE`,
+		dose.PlanID, dose.ScheduledAt).Scan(&linked)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	logged := false
+	switch {
+	case dose.MetricID != nil:
+	case linked != nil && dose.Status == DoseTaken:
+		dose.MetricID = linked
+	case metric != nil:
+		err = MedicationMetricModel{DB: m.DB}.InsertMedicationMetricTx(tx, userID, metric)
+		if err != nil {
+			return false, err
+		}
+		dose.MetricID = &metric.ID
+		logged = true
+	}
+	query := `
+	INSERT INTO medication_doses (plan_id, user_id, scheduled_at, status, metric_id)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (plan_id, scheduled_at) DO UPDATE SET status = EXCLUDED.status,
+	metric_id = EXCLUDED.metric_id, recorded_at = NOW()
+	RETURNING recorded_at`
+	var recordedAt time.Time
+	err = tx.QueryRowContext(ctx, query, dose.PlanID, userID, dose.ScheduledAt, dose.Status, dose.MetricID).Scan(&recordedAt)
+	if err != nil {
+		return false, err
+	}
+	dose.RecordedAt = &recordedAt
+	return logged, tx.Commit()
+}
+
+// DeleteDose() forgets the answer given for a dose. The medication metric it was
+// logged as is kept.
+func (m MedicationPlanModel) DeleteDose(userID string, planID int64, scheduledAt time.Time) error {
+	query := ` DELETE FROM medication_doses WHERE plan_id = $1 AND user_id = $2 AND scheduled_at = $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, planID, userID, scheduledAt)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// MedicationReminder is a user with the plans that have reminders on and are active
+// on the day the reminders are for.
+type MedicationReminder struct {
+	UserID    string
+	Email     string
+	FirstName string
+	Plans     []*MedicationPlan
+}
+
+// GetReminders() lists the activated users with plans active on date that have
+// reminders on, with those plans.
+func (m MedicationPlanModel) GetReminders(date time.Time) ([]*MedicationReminder, error) {
+	query := `
+	SELECT users.id, users.email, users.first_name,
+	mp.id, mp.name, mp.dose, mp.unit, mp.frequency, mp.times, mp.start_date, mp.end_date
+	FROM medication_plans mp
+	INNER JOIN users ON users.id = mp.user_id
+	WHERE users.activated AND mp.reminders
+	AND mp.start_date <= $1 AND (mp.end_date IS NULL OR mp.end_date >= $1)
+	ORDER BY users.id, mp.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reminders := []*MedicationReminder{}
+	for rows.Next() {
+		var reminder MedicationReminder
+		plan := MedicationPlan{Reminders: true}
+		err := rows.Scan(&reminder.UserID, &reminder.Email, &reminder.FirstName, &plan.ID, &plan.Name, &plan.Dose,
+			&plan.Unit, &plan.Frequency, pq.Array(&plan.Times), &plan.StartDate, &plan.EndDate)
+		if err != nil {
+			return nil, err
+		}
+		plan.UserID = reminder.UserID
+		if n := len(reminders); n > 0 && reminders[n-1].UserID == reminder.UserID {
+			reminders[n-1].Plans = append(reminders[n-1].Plans, &plan)
+			continue
+		}
+		reminder.Plans = []*MedicationPlan{&plan}
+		reminders = append(reminders, &reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
@@ -51,6 +51,37 @@ func (m MedicationMetricModel) GetUserMedicationMetrics(userId string, date time
 	return medicationMetrics, nil
 }
 
+// GetUserMedicationMetricsSince() returns the medications of a user from since
+// onwards, ordered by date.
+func (m MedicationMetricModel) GetUserMedicationMetricsSince(userId string, since time.Time) ([]*MedicationMetric, error) {
+	query := `
+	SELECT umm.id, umm.time, umm.dosage, umm.quantity, umm.name, umm.date, umm.metric
+    FROM user_medication_metric umm
+    WHERE umm.user_id = $1 AND umm.date >= $2
+    ORDER BY umm.date, umm.id
+    `
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userId, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	medicationMetrics := []*MedicationMetric{}
+	for rows.Next() {
+		var medicationMetric MedicationMetric
+		err := rows.Scan(&medicationMetric.ID, &medicationMetric.Time, &medicationMetric.Dosage, &medicationMetric.Quantity, &medicationMetric.Name, &medicationMetric.Date, &medicationMetric.Metric)
+		if err != nil {
+			return nil, err
+		}
+		medicationMetrics = append(medicationMetrics, &medicationMetric)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return medicationMetrics, nil
+}
+
 func (m MedicationMetricModel) GetUserMedicationMetric(userId string, id int64) (*MedicationMetric, error) {
 	query := `
     SELECT umm.id, umm.time, umm.dosage, umm.quantity, umm.name, umm.date, umm.metric
@@ -73,19 +104,23 @@ func (m MedicationMetricModel) GetUserMedicationMetric(userId string, id int64)
 }
 
 func (m MedicationMetricModel) InsertMedicationMetric(userID string, medicationMetric *MedicationMetric) error {
+	return insertMedicationMetric(m.DB, userID, medicationMetric)
+}
+
+func (m MedicationMetricModel) InsertMedicationMetricTx(tx *sql.Tx, userID string, medicationMetric *MedicationMetric) error {
+	return insertMedicationMetric(tx, userID, medicationMetric)
+}
 
+func insertMedicationMetric(db execer, userID string, medicationMetric *MedicationMetric) error {
 	query := `
 	INSERT INTO user_medication_metric (user_id, time, dosage, quantity, date, name, metric)
-	VALUES ($1, $2, $3, $4, $5, $6, $7) `
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id`
 
 	args := []any{userID, medicationMetric.Time, medicationMetric.Dosage, medicationMetric.Quantity, medicationMetric.Date, medicationMetric.Name, medicationMetric.Metric}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-	return nil
+	return db.QueryRowContext(ctx, query, args...).Scan(&medicationMetric.ID)
 }
 
 func (m MedicationMetricModel) UpdateMedicationMetric(medicationMetric *MedicationMetric) error {
@@ -50,18 +50,23 @@ func (m MensesModels) GetMenses(id string) (*Menses, error) {
 }
 
 func (m MensesModels) InsertMenses(menses *Menses) error {
+	return insertMenses(m.DB, menses)
+}
+
+func (m MensesModels) InsertMensesTx(tx *sql.Tx, menses *Menses) error {
+	return insertMenses(tx, menses)
+}
+
+func insertMenses(db execer, menses *Menses) error {
 	query := `
 	INSERT INTO menstruation (user_id, period_len, cycle_len)
 	VALUES ($1, $2, $3) `
 
-	args := []any{menses.Id, menses.Cycle_len, menses.Period_len}
+	args := []any{menses.Id, menses.Period_len, menses.Cycle_len}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
 }
 
 func (m MensesModels) UpdateMenses(menses *Menses) error {
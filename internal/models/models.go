@@ -14,6 +14,15 @@ var (
 type Models struct {
 	Users            UserModel
 	Tokens           TokenModel
+	EmailChanges     EmailChangeModel
+	Notifications    NotificationModel
+	LoginAttempts    LoginAttemptModel
+	Permissions      PermissionModel
+	TOTP             TOTPModel
+	AccountDeletions AccountDeletionModel
+	AuditLog         AuditLogModel
+	DataExports      DataExportModel
+	DataImports      DataImportModel
 	Metrics          MetricsModel
 	Smileys          SmileysModel
 	Symptoms         SymptomsModel
@@ -26,8 +35,11 @@ type Models struct {
 	FoodMetric       FoodMetricModel
 	ExerciseMetric   ExerciseMetricModel
 	UrineMetric      UrineMetricModel
+	HydrationMetric  HydrationMetricModel
 	BowelMetric      BowelMetricModel
 	MedicationMetric MedicationMetricModel
+	MedicationPlans  MedicationPlanModel
+	Medications      MedicationModel
 	AnalyticsMetric  AnalyticsModel
 	UserPoint        UserPointModel
 	UserPeriod       UserPeriodModel
@@ -38,6 +50,15 @@ func NewModels(db *sql.DB) Models {
 	return Models{
 		Users:            UserModel{DB: db},
 		Tokens:           TokenModel{DB: db},
+		EmailChanges:     EmailChangeModel{DB: db},
+		Notifications:    NotificationModel{DB: db},
+		LoginAttempts:    LoginAttemptModel{DB: db},
+		Permissions:      PermissionModel{DB: db},
+		TOTP:             TOTPModel{DB: db},
+		AccountDeletions: AccountDeletionModel{DB: db},
+		AuditLog:         AuditLogModel{DB: db},
+		DataExports:      DataExportModel{DB: db},
+		DataImports:      DataImportModel{DB: db},
 		Metrics:          MetricsModel{DB: db},
 		Smileys:          SmileysModel{DB: db},
 		Symptoms:         SymptomsModel{DB: db},
@@ -50,8 +71,11 @@ func NewModels(db *sql.DB) Models {
 		FoodMetric:       FoodMetricModel{DB: db},
 		ExerciseMetric:   ExerciseMetricModel{DB: db},
 		UrineMetric:      UrineMetricModel{DB: db},
+		HydrationMetric:  HydrationMetricModel{DB: db},
 		BowelMetric:      BowelMetricModel{DB: db},
 		MedicationMetric: MedicationMetricModel{DB: db},
+		MedicationPlans:  MedicationPlanModel{DB: db},
+		Medications:      MedicationModel{DB: db},
 		AnalyticsMetric:  AnalyticsModel{DB: db},
 		UserPoint:        UserPointModel{DB: db},
 		UserPeriod:       UserPeriodModel{DB: db},
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type NotificationPreferences struct {
+	UserID         string `json:"-"`
+	PeriodUpcoming bool   `json:"period_upcoming"`
+	PeriodLate     bool   `json:"period_late"`
+}
+
+// NotificationRecipient is a user with a logged cycle and their preferences.
+type NotificationRecipient struct {
+	UserID      string
+	Email       string
+	FirstName   string
+	Preferences NotificationPreferences
+}
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// GetPreferences() returns the preferences of a user; every notification is on
+// until the user changes it.
+func (m NotificationModel) GetPreferences(userID string) (*NotificationPreferences, error) {
+	query := ` SELECT period_upcoming, period_late FROM notification_preferences WHERE user_id = $1`
+	prefs := NotificationPreferences{UserID: userID, PeriodUpcoming: true, PeriodLate: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&prefs.PeriodUpcoming, &prefs.PeriodLate)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+func (m NotificationModel) UpdatePreferences(prefs *NotificationPreferences) error {
+	query := ` INSERT INTO notification_preferences (user_id, period_upcoming, period_late)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE SET period_upcoming = EXCLUDED.period_upcoming,
+	period_late = EXCLUDED.period_late, updated_at = NOW()`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, prefs.UserID, prefs.PeriodUpcoming, prefs.PeriodLate)
+	return err
+}
+
+// GetRecipients() lists the activated users who logged at least one cycle and left
+// at least one period notification on, leaving out users who are pregnant or past
+// menopause.
+func (m NotificationModel) GetRecipients() ([]NotificationRecipient, error) {
+	query := ` SELECT users.id, users.email, users.first_name,
+	COALESCE(np.period_upcoming, true), COALESCE(np.period_late, true)
+	FROM users
+	LEFT JOIN notification_preferences np ON np.user_id = users.id
+	WHERE users.activated
+	AND (np.user_id IS NULL OR np.period_upcoming OR np.period_late)
+	AND EXISTS (SELECT 1 FROM menstrual_cycles WHERE menstrual_cycles.user_id = users.id)
+	AND NOT EXISTS (SELECT 1 FROM user_tracking_modes tm WHERE tm.user_id = users.id
+		AND tm.mode IN ('pregnancy', 'menopause'))`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	recipients := []NotificationRecipient{}
+	for rows.Next() {
+		var recipient NotificationRecipient
+		err := rows.Scan(&recipient.UserID, &recipient.Email, &recipient.FirstName,
+			&recipient.Preferences.PeriodUpcoming, &recipient.Preferences.PeriodLate)
+		if err != nil {
+			return nil, err
+		}
+		recipient.Preferences.UserID = recipient.UserID
+		recipients = append(recipients, recipient)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// MarkSent() records a notification about referenceDate. It reports false when the
+// notification was already sent, in which case it must not be sent again.
+func (m NotificationModel) MarkSent(userID, kind string, referenceDate time.Time) (bool, error) {
+	query := ` INSERT INTO notifications_sent (user_id, kind, reference_date) VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, kind, referenceDate)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UnmarkSent() forgets a notification that could not be delivered so the next run
+// tries again.
+func (m NotificationModel) UnmarkSent(userID, kind string, referenceDate time.Time) error {
+	query := ` DELETE FROM notifications_sent WHERE user_id = $1 AND kind = $2 AND reference_date = $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, kind, referenceDate)
+	return err
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/olagookundavid/itoju/internal/validator"
+)
+
+// Cervical mucus qualities, from least to most fertile.
+const (
+	MucusDry      = "dry"
+	MucusSticky   = "sticky"
+	MucusCreamy   = "creamy"
+	MucusWatery   = "watery"
+	MucusEggWhite = "egg_white"
+)
+
+var CervicalMucusQualities = []string{MucusDry, MucusSticky, MucusCreamy, MucusWatery, MucusEggWhite}
+
+const (
+	minTemperature = 34
+	maxTemperature = 42
+	// The three-over-six rule: three readings above the highest of the six before
+	// them, the third at least thermalShift degrees above it.
+	lowReadings  = 6
+	highReadings = 3
+	thermalShift = 0.2
+	// peakMucusWindow is how many days before the temperature shift the last day of
+	// fertile mucus may fall to be taken as the ovulation day.
+	peakMucusWindow = 3
+	// fertileWindowBefore is how many days before ovulation the fertile window opens.
+	fertileWindowBefore = 5
+)
+
+func ValidateCycleDay(v *validator.Validator, day *CycleDay) {
+	if day.Temperature != nil {
+		v.Check(*day.Temperature >= minTemperature && *day.Temperature <= maxTemperature, "temperature", "must be between 34 and 42 degrees Celsius")
+	}
+	if day.CervicalMucus != "" {
+		v.Check(validator.PermittedValue(day.CervicalMucus, CervicalMucusQualities...), "cervical_mucus", "must be one of dry, sticky, creamy, watery or egg_white")
+	}
+}
+
+// ConfirmedOvulation() applies the sympto-thermal rule to days sorted by date. The
+// temperature shift is found with the three-over-six rule; when the third high
+// reading is not far enough above the others a fourth high reading is accepted
+// instead. Ovulation is the last day of fertile mucus shortly before the shift, or
+// the day before the first high reading when no mucus was logged.
+func ConfirmedOvulation(days []CycleDay) (time.Time, bool) {
+	var readings []CycleDay
+	for _, day := range days {
+		if day.Temperature != nil {
+			readings = append(readings, day)
+		}
+	}
+	for i := lowReadings; i+highReadings <= len(readings); i++ {
+		coverline := 0.0
+		for _, reading := range readings[i-lowReadings : i] {
+			if *reading.Temperature > coverline {
+				coverline = *reading.Temperature
+			}
+		}
+		high := 0
+		for _, reading := range readings[i:] {
+			if *reading.Temperature <= coverline {
+				break
+			}
+			high++
+			if high >= highReadings && (*reading.Temperature >= coverline+thermalShift || high > highReadings) {
+				return ovulationBeforeShift(days, readings[i].Date), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func ovulationBeforeShift(days []CycleDay, shift time.Time) time.Time {
+	ovulation := shift.AddDate(0, 0, -1)
+	for _, day := range days {
+		if !day.Date.Before(shift) {
+			break
+		}
+		fertile := day.CervicalMucus == MucusWatery || day.CervicalMucus == MucusEggWhite
+		if fertile && !day.Date.Before(shift.AddDate(0, 0, -peakMucusWindow)) {
+			ovulation = day.Date
+		}
+	}
+	return ovulation
+}
+
+// setPhaseFlags() marks the ovulation day, the fertile window (the five days before
+// ovulation and the day after, outside the period) and the luteal phase, counting
+// days from start. Days the user marked or unmarked as ovulation keep their flag.
+func setPhaseFlags(days []CycleDay, start time.Time, ovulation int) {
+	for i := range days {
+		index := int(TruncateToDay(days[i].Date).Sub(TruncateToDay(start)).Hours() / 24)
+		if !days[i].OvulationSetByUser {
+			days[i].IsOvulation = index == ovulation
+		}
+		days[i].IsFertile = !days[i].IsPeriod && index >= ovulation-fertileWindowBefore && index <= ovulation+1
+		days[i].IsLuteal = index > ovulation
+	}
+}
+
+// applyConfirmedOvulation() re-anchors the phase flags of a cycle's days on the
+// ovulation day the user marked, else on the confirmed ovulation, or on the estimate
+// when there is neither and the tracking mode estimates one. The confirmation is
+// recorded on the cycle either way.
+func applyConfirmedOvulation(cycle *MenstrualCycle, days []CycleDay, mode string) {
+	cycle.ConfirmedOvulationDate = nil
+	date, anchored := ConfirmedOvulation(days)
+	if anchored {
+		cycle.ConfirmedOvulationDate = &date
+	}
+	if marked, ok := markedOvulation(days); ok {
+		date, anchored = marked, true
+	}
+	if anchored {
+		setPhaseFlags(days, cycle.StartDate, int(TruncateToDay(date).Sub(TruncateToDay(cycle.StartDate)).Hours()/24))
+		return
+	}
+	if estimatesOvulation(mode) {
+		setPhaseFlags(days, cycle.StartDate, ovulationDay(cycle.CycleLength, cycle.PeriodLength, lutealPhaseLength))
+		return
+	}
+	for i := range days {
+		if !days[i].OvulationSetByUser {
+			days[i].IsOvulation = false
+		}
+		days[i].IsFertile = false
+		days[i].IsLuteal = false
+	}
+}
+
+// markedOvulation() returns the day the user marked as ovulation themselves.
+func markedOvulation(days []CycleDay) (time.Time, bool) {
+	for _, day := range days {
+		if day.OvulationSetByUser && day.IsOvulation {
+			return day.Date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ConfirmOvulation() runs the sympto-thermal rule over the days of a cycle, stores
+// the confirmed ovulation date on the cycle and updates the day flags to match.
+func (m *UserPeriodModel) ConfirmOvulation(cycle *MenstrualCycle, mode string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.confirmOvulationTx(tx, cycle, mode)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *UserPeriodModel) confirmOvulationTx(tx *sql.Tx, cycle *MenstrualCycle, mode string) error {
+	days, err := m.GetCycleDaysTx(tx, cycle.ID, cycle.UserID)
+	if err != nil {
+		return err
+	}
+	applyConfirmedOvulation(cycle, days, mode)
+	err = m.setConfirmedOvulationTx(tx, cycle)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE cycles_days SET is_ovulation = $1, is_fertile = $2, is_luteal = $3 WHERE id = $4`
+	for _, day := range days {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, err := tx.ExecContext(ctx, query, day.IsOvulation, day.IsFertile, day.IsLuteal, day.ID)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *UserPeriodModel) setConfirmedOvulationTx(tx *sql.Tx, cycle *MenstrualCycle) error {
+	query := `UPDATE menstrual_cycles SET confirmed_ovulation_date = $1 WHERE id = $2 AND user_id = $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, cycle.ConfirmedOvulationDate, cycle.ID, cycle.UserID)
+	return err
+}
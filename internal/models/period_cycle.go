@@ -7,14 +7,16 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/olagookundavid/itoju/internal/validator"
 )
 
 type MenstrualCycle struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"user_id"`
-	StartDate    time.Time `json:"start_date"`
-	CycleLength  int       `json:"cycle_length"`
-	PeriodLength int       `json:"period_length"`
+	ID                     string     `json:"id"`
+	UserID                 string     `json:"user_id"`
+	StartDate              time.Time  `json:"start_date"`
+	CycleLength            int        `json:"cycle_length"`
+	PeriodLength           int        `json:"period_length"`
+	ConfirmedOvulationDate *time.Time `json:"confirmed_ovulation_date"`
 }
 
 type CycleDay struct {
@@ -24,10 +26,18 @@ type CycleDay struct {
 	Date        time.Time `json:"date"`
 	IsPeriod    bool      `json:"is_period"`
 	IsOvulation bool      `json:"is_ovulation"`
-	Flow        float32   `json:"flow"`
-	Pain        float32   `json:"pain"`
-	Tags        []string  `json:"tags"`
-	CMQ         string    `json:"cmq"`
+	// OvulationSetByUser is set once the user marks or unmarks the day as ovulation
+	// themselves, after which IsOvulation is no longer estimated or confirmed.
+	OvulationSetByUser bool     `json:"ovulation_set_by_user"`
+	IsFertile          bool     `json:"is_fertile"`
+	IsLuteal           bool     `json:"is_luteal"`
+	Flow               float32  `json:"flow"`
+	Pain               float32  `json:"pain"`
+	Tags               []string `json:"tags"`
+	CMQ                string   `json:"cmq"`
+	// Temperature is the basal body temperature in degrees Celsius.
+	Temperature   *float64 `json:"temperature"`
+	CervicalMucus string   `json:"cervical_mucus"`
 }
 
 type UserPeriodModel struct {
@@ -46,6 +56,21 @@ func (m *UserPeriodModel) ReturnCycleDay(cycleID, userID string, isPeriod, isOvu
 	}
 }
 
+// GenerateCycleDays() lays out the days of a cycle. Ovulation is placed a luteal
+// phase before the next period, the fertile window covers the five days before it
+// and the day after, and every day after ovulation belongs to the luteal phase.
+// Tracking modes without regular ovulation only get the period days marked.
+func (m *UserPeriodModel) GenerateCycleDays(cycleID, userID string, startDate time.Time, cycleLength, periodLength int, mode string) []CycleDay {
+	days := make([]CycleDay, 0, cycleLength)
+	for i := 0; i < cycleLength; i++ {
+		days = append(days, m.ReturnCycleDay(cycleID, userID, i < periodLength, false, startDate.AddDate(0, 0, i)))
+	}
+	if estimatesOvulation(mode) {
+		setPhaseFlags(days, startDate, ovulationDay(cycleLength, periodLength, lutealPhaseLength))
+	}
+	return days
+}
+
 // func (m *UserPeriodModel) ReturnCycleDay(CMQ string, cycleID, flow, pain int, isPeriod, isOvulation bool, date time.Time, tags []string) CycleDay {
 // 	return CycleDay{
 // 		CMQ: CMQ, CycleID: cycleID, Flow: flow, Pain: pain, IsPeriod: isPeriod, IsOvulation: isOvulation, Date: date,
@@ -53,10 +78,16 @@ func (m *UserPeriodModel) ReturnCycleDay(cycleID, userID string, isPeriod, isOvu
 // }
 
 func (m *UserPeriodModel) GetMenstrualCycles(userID string) ([]MenstrualCycle, error) {
-	query := `SELECT id, user_id, start_date, cycle_length, period_length
+	return getMenstrualCycles(m.DB, userID)
+}
+
+func getMenstrualCycles(db execer, userID string) ([]MenstrualCycle, error) {
+	query := `SELECT id, user_id, start_date, cycle_length, period_length, confirmed_ovulation_date
               FROM menstrual_cycles WHERE user_id = $1 ORDER BY start_date DESC`
 
-	rows, err := m.DB.Query(query, userID)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +96,7 @@ func (m *UserPeriodModel) GetMenstrualCycles(userID string) ([]MenstrualCycle, e
 	var cycles []MenstrualCycle
 	for rows.Next() {
 		var cycle MenstrualCycle
-		err := rows.Scan(&cycle.ID, &cycle.UserID, &cycle.StartDate, &cycle.CycleLength, &cycle.PeriodLength)
+		err := rows.Scan(&cycle.ID, &cycle.UserID, &cycle.StartDate, &cycle.CycleLength, &cycle.PeriodLength, &cycle.ConfirmedOvulationDate)
 		if err != nil {
 			return nil, err
 		}
@@ -75,15 +106,25 @@ func (m *UserPeriodModel) GetMenstrualCycles(userID string) ([]MenstrualCycle, e
 }
 
 func (m *UserPeriodModel) GetCycleDays(cycleID, userID string) ([]CycleDay, error) {
+	return getCycleDays(m.DB, cycleID, userID)
+}
+
+func (m *UserPeriodModel) GetCycleDaysTx(tx *sql.Tx, cycleID, userID string) ([]CycleDay, error) {
+	return getCycleDays(tx, cycleID, userID)
+}
+
+func getCycleDays(db execer, cycleID, userID string) ([]CycleDay, error) {
 
 	if cycleID == "" {
 		return []CycleDay{}, nil
 	}
 
-	query := `SELECT id, cycle_id, date, is_period, is_ovulation, flow, pain, tags, cmq
+	query := `SELECT id, cycle_id, date, is_period, is_ovulation, ovulation_set_by_user, is_fertile, is_luteal, flow, pain, tags, cmq, temperature, cervical_mucus
               FROM cycles_days WHERE cycle_id = $1 AND user_id = $2 ORDER BY date ASC`
 
-	rows, err := m.DB.Query(query, cycleID, userID)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, cycleID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +133,7 @@ func (m *UserPeriodModel) GetCycleDays(cycleID, userID string) ([]CycleDay, erro
 	var days []CycleDay
 	for rows.Next() {
 		var day CycleDay
-		err := rows.Scan(&day.ID, &day.CycleID, &day.Date, &day.IsPeriod, &day.IsOvulation, &day.Flow, &day.Pain, pq.Array(&day.Tags), &day.CMQ)
+		err := rows.Scan(&day.ID, &day.CycleID, &day.Date, &day.IsPeriod, &day.IsOvulation, &day.OvulationSetByUser, &day.IsFertile, &day.IsLuteal, &day.Flow, &day.Pain, pq.Array(&day.Tags), &day.CMQ, &day.Temperature, &day.CervicalMucus)
 		if err != nil {
 			return nil, err
 		}
@@ -104,6 +145,34 @@ func (m *UserPeriodModel) GetCycleDays(cycleID, userID string) ([]CycleDay, erro
 	return days, nil
 }
 
+// GetCycleDaysSince() returns the cycle days of a user from since onwards, across
+// all of their cycles.
+func (m *UserPeriodModel) GetCycleDaysSince(userID string, since time.Time) ([]CycleDay, error) {
+	query := `SELECT id, cycle_id, date, is_period, is_ovulation, ovulation_set_by_user, is_fertile, is_luteal, flow, pain, tags, cmq, temperature, cervical_mucus
+              FROM cycles_days WHERE user_id = $1 AND date >= $2 ORDER BY date ASC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []CycleDay{}
+	for rows.Next() {
+		var day CycleDay
+		err := rows.Scan(&day.ID, &day.CycleID, &day.Date, &day.IsPeriod, &day.IsOvulation, &day.OvulationSetByUser, &day.IsFertile, &day.IsLuteal, &day.Flow, &day.Pain, pq.Array(&day.Tags), &day.CMQ, &day.Temperature, &day.CervicalMucus)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return days, nil
+}
+
 func (m *UserPeriodModel) InsertMenstrualCycleTx(tx *sql.Tx, cycle *MenstrualCycle) (string, error) {
 	query := `INSERT INTO menstrual_cycles (user_id, start_date, cycle_length, period_length, created_at)
               VALUES ($1, $2, $3, $4, $5) RETURNING id`
@@ -114,7 +183,7 @@ func (m *UserPeriodModel) InsertMenstrualCycleTx(tx *sql.Tx, cycle *MenstrualCyc
 	err := tx.QueryRowContext(ctx, query, cycle.UserID, cycle.StartDate, cycle.CycleLength, cycle.PeriodLength, time.Now()).Scan(&id)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "menstrual_cycles_start_date_key"`:
+		case err.Error() == `pq: duplicate key value violates unique constraint "menstrual_cycles_user_id_start_date_key"`:
 			return "", ErrRecordAlreadyExist
 		default:
 			return "", err
@@ -124,13 +193,13 @@ func (m *UserPeriodModel) InsertMenstrualCycleTx(tx *sql.Tx, cycle *MenstrualCyc
 }
 
 func (m *UserPeriodModel) InsertCycleDayTx(tx *sql.Tx, day *CycleDay) error {
-	query := `INSERT INTO cycles_days (cycle_id, user_id, date, is_period, is_ovulation, flow, pain, tags, cmq, created_at)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	query := `INSERT INTO cycles_days (cycle_id, user_id, date, is_period, is_ovulation, ovulation_set_by_user, is_fertile, is_luteal, flow, pain, tags, cmq, temperature, cervical_mucus, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := tx.ExecContext(ctx, query, day.CycleID, day.UserID, day.Date, day.IsPeriod, day.IsOvulation, day.Flow, day.Pain, pq.Array(day.Tags), day.CMQ, time.Now())
+	_, err := tx.ExecContext(ctx, query, day.CycleID, day.UserID, day.Date, day.IsPeriod, day.IsOvulation, day.OvulationSetByUser, day.IsFertile, day.IsLuteal, day.Flow, day.Pain, pq.Array(day.Tags), day.CMQ, day.Temperature, day.CervicalMucus, time.Now())
 	if err != nil {
 
 		print(err.Error())
@@ -141,9 +210,9 @@ func (m *UserPeriodModel) InsertCycleDayTx(tx *sql.Tx, day *CycleDay) error {
 
 func (m *UserPeriodModel) UpdateCycleDay(cycleDay *CycleDay) error {
 
-	query := `UPDATE cycles_days SET flow = $1, pain = $2, is_ovulation = $3, is_period = $4, cmq = $5, tags = $6  WHERE id = $7`
+	query := `UPDATE cycles_days SET flow = $1, pain = $2, is_ovulation = $3, is_period = $4, cmq = $5, tags = $6, temperature = $7, cervical_mucus = $8, ovulation_set_by_user = $9  WHERE id = $10`
 
-	args := []any{cycleDay.Flow, cycleDay.Pain, cycleDay.IsOvulation, cycleDay.IsPeriod, cycleDay.CMQ, pq.Array(cycleDay.Tags), cycleDay.ID}
+	args := []any{cycleDay.Flow, cycleDay.Pain, cycleDay.IsOvulation, cycleDay.IsPeriod, cycleDay.CMQ, pq.Array(cycleDay.Tags), cycleDay.Temperature, cycleDay.CervicalMucus, cycleDay.OvulationSetByUser, cycleDay.ID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, args...)
@@ -162,7 +231,7 @@ func (m *UserPeriodModel) GetCycleDay(id string) (*CycleDay, error) {
 	if id == "" {
 		return nil, ErrRecordNotFound
 	}
-	query := ` SELECT id, cycle_id, date, is_period, is_ovulation, flow, pain, tags, cmq FROM cycles_days WHERE id = $1; `
+	query := ` SELECT id, cycle_id, date, is_period, is_ovulation, ovulation_set_by_user, is_fertile, is_luteal, flow, pain, tags, cmq, temperature, cervical_mucus FROM cycles_days WHERE id = $1; `
 	var cycleDay CycleDay
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -172,10 +241,15 @@ func (m *UserPeriodModel) GetCycleDay(id string) (*CycleDay, error) {
 		&cycleDay.Date,
 		&cycleDay.IsPeriod,
 		&cycleDay.IsOvulation,
+		&cycleDay.OvulationSetByUser,
+		&cycleDay.IsFertile,
+		&cycleDay.IsLuteal,
 		&cycleDay.Flow,
 		&cycleDay.Pain,
 		pq.Array(&cycleDay.Tags),
 		&cycleDay.CMQ,
+		&cycleDay.Temperature,
+		&cycleDay.CervicalMucus,
 	)
 
 	if err != nil {
@@ -218,3 +292,211 @@ func (m *UserPeriodModel) GetMensesCycleIds(id string) ([]string, error) {
 
 	return cycleDayIds, nil
 }
+
+func ValidateMenstrualCycle(v *validator.Validator, cycle *MenstrualCycle) {
+	v.Check(!cycle.StartDate.IsZero(), "start_date", "must be provided")
+	v.Check(cycle.CycleLength >= minObservedCycleLength, "cycle_length", "must be at least 15 days")
+	v.Check(cycle.CycleLength <= maxObservedCycleLength, "cycle_length", "must not be more than 90 days")
+	v.Check(cycle.PeriodLength > 0, "period_length", "must be greater than zero")
+	v.Check(cycle.PeriodLength < cycle.CycleLength, "period_length", "must be shorter than the cycle")
+}
+
+func (m *UserPeriodModel) GetMenstrualCycle(id, userID string) (*MenstrualCycle, error) {
+	query := `SELECT id, user_id, start_date, cycle_length, period_length, confirmed_ovulation_date
+              FROM menstrual_cycles WHERE id = $1 AND user_id = $2`
+	var cycle MenstrualCycle
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&cycle.ID, &cycle.UserID, &cycle.StartDate, &cycle.CycleLength, &cycle.PeriodLength, &cycle.ConfirmedOvulationDate)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &cycle, nil
+}
+
+func (m *UserPeriodModel) UpdateMenstrualCycleTx(tx *sql.Tx, cycle *MenstrualCycle) error {
+	query := `UPDATE menstrual_cycles SET start_date = $1, cycle_length = $2, period_length = $3
+              WHERE id = $4 AND user_id = $5`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := tx.ExecContext(ctx, query, cycle.StartDate, cycle.CycleLength, cycle.PeriodLength, cycle.ID, cycle.UserID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "menstrual_cycles_user_id_start_date_key"`:
+			return ErrRecordAlreadyExist
+		default:
+			return err
+		}
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// RegenerateCycleDaysTx() replaces the days of a cycle with freshly generated ones.
+// Flow, pain, tags, cmq, temperature, cervical mucus and an ovulation the user marked
+// for a date that is still part of the cycle are carried over to the new day, and
+// ovulation is confirmed again from them.
+func (m *UserPeriodModel) RegenerateCycleDaysTx(tx *sql.Tx, cycle *MenstrualCycle, mode string) ([]CycleDay, error) {
+	query := `DELETE FROM cycles_days WHERE cycle_id = $1 AND user_id = $2
+              RETURNING date, flow, pain, tags, cmq, temperature, cervical_mucus, is_ovulation, ovulation_set_by_user`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, cycle.ID, cycle.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entered := map[string]CycleDay{}
+	for rows.Next() {
+		var day CycleDay
+		err := rows.Scan(&day.Date, &day.Flow, &day.Pain, pq.Array(&day.Tags), &day.CMQ, &day.Temperature, &day.CervicalMucus, &day.IsOvulation, &day.OvulationSetByUser)
+		if err != nil {
+			return nil, err
+		}
+		entered[day.Date.Format("2006-01-02")] = day
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	days := m.GenerateCycleDays(cycle.ID, cycle.UserID, cycle.StartDate, cycle.CycleLength, cycle.PeriodLength, mode)
+	for i := range days {
+		if old, ok := entered[days[i].Date.Format("2006-01-02")]; ok {
+			days[i].Flow = old.Flow
+			days[i].Pain = old.Pain
+			days[i].Tags = old.Tags
+			days[i].CMQ = old.CMQ
+			days[i].Temperature = old.Temperature
+			days[i].CervicalMucus = old.CervicalMucus
+			if old.OvulationSetByUser {
+				days[i].IsOvulation = old.IsOvulation
+				days[i].OvulationSetByUser = true
+			}
+		}
+	}
+	applyConfirmedOvulation(cycle, days, mode)
+	err = m.setConfirmedOvulationTx(tx, cycle)
+	if err != nil {
+		return nil, err
+	}
+	for i := range days {
+		err := m.InsertCycleDayTx(tx, &days[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return days, nil
+}
+
+// DeleteMenstrualCycle() removes a cycle; its days go with it through the foreign key.
+func (m *UserPeriodModel) DeleteMenstrualCycle(id, userID string) error {
+	query := `DELETE FROM menstrual_cycles WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// ValidateCycleOverlap() adds a validation error when the period of the cycle shares
+// a day with the period of another cycle of the same user. Only periods are compared:
+// a cycle really ends when the next one starts, so a period that comes earlier than
+// cycle_length predicted is fine and FitCycleTx() shortens the cycle before it. A
+// cycle starting on the same day is left to the unique constraint.
+func (m *UserPeriodModel) ValidateCycleOverlap(v *validator.Validator, cycle *MenstrualCycle) error {
+	return validateCycleOverlap(m.DB, v, cycle)
+}
+
+func (m *UserPeriodModel) ValidateCycleOverlapTx(tx *sql.Tx, v *validator.Validator, cycle *MenstrualCycle) error {
+	return validateCycleOverlap(tx, v, cycle)
+}
+
+func validateCycleOverlap(db execer, v *validator.Validator, cycle *MenstrualCycle) error {
+	query := `SELECT start_date FROM menstrual_cycles
+              WHERE user_id = $1 AND ($2 = '' OR id::text <> $2) AND start_date <> $3::date
+              AND start_date < $3::date + $4::int AND $3::date < start_date + period_length
+              ORDER BY start_date LIMIT 1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var startDate time.Time
+	err := db.QueryRowContext(ctx, query, cycle.UserID, cycle.ID, cycle.StartDate, cycle.PeriodLength).Scan(&startDate)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	v.AddError("start_date", "overlaps the period of the cycle starting on "+startDate.Format("2006-01-02"))
+	return nil
+}
+
+// FitCycleTx() keeps cycles of a user from sharing days, a cycle ending when the next
+// one starts. It shortens cycle when it runs into the next cycle, and shortens the
+// cycle before it, regenerating its days, when cycle starts before that one ended.
+// It is called before the days of cycle are written.
+func (m *UserPeriodModel) FitCycleTx(tx *sql.Tx, cycle *MenstrualCycle, mode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var next time.Time
+	err := tx.QueryRowContext(ctx, `SELECT start_date FROM menstrual_cycles
+              WHERE user_id = $1 AND ($2 = '' OR id::text <> $2) AND start_date > $3::date
+              ORDER BY start_date LIMIT 1`, cycle.UserID, cycle.ID, cycle.StartDate).Scan(&next)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil {
+		if gap := daysBetween(cycle.StartDate, next); gap < cycle.CycleLength {
+			cycle.CycleLength = gap
+		}
+	}
+
+	var previous MenstrualCycle
+	err = tx.QueryRowContext(ctx, `SELECT id, user_id, start_date, cycle_length, period_length, confirmed_ovulation_date
+              FROM menstrual_cycles
+              WHERE user_id = $1 AND ($2 = '' OR id::text <> $2) AND start_date < $3::date
+              ORDER BY start_date DESC LIMIT 1`, cycle.UserID, cycle.ID, cycle.StartDate).Scan(&previous.ID, &previous.UserID,
+		&previous.StartDate, &previous.CycleLength, &previous.PeriodLength, &previous.ConfirmedOvulationDate)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	gap := daysBetween(previous.StartDate, cycle.StartDate)
+	if gap >= previous.CycleLength {
+		return nil
+	}
+	previous.CycleLength = gap
+	err = m.UpdateMenstrualCycleTx(tx, &previous)
+	if err != nil {
+		return err
+	}
+	_, err = m.RegenerateCycleDaysTx(tx, &previous, mode)
+	return err
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(TruncateToDay(to).Sub(TruncateToDay(from)).Hours() / 24)
+}
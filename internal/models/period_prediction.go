@@ -0,0 +1,341 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultCycleLength  = 28
+	DefaultPeriodLength = 5
+
+	// lutealPhaseLength is the usual number of days between ovulation and the next
+	// period. It varies far less between people than the follicular phase does.
+	lutealPhaseLength = 14
+	// predictionHistoryLimit is how many of the latest cycles feed the statistics.
+	predictionHistoryLimit = 12
+	// Observed gaps outside this range are most likely missed logs, not real cycles.
+	minObservedCycleLength = 15
+	maxObservedCycleLength = 90
+	// Luteal phases measured outside this range are ignored.
+	minLutealPhaseLength = 10
+	maxLutealPhaseLength = 17
+	// defaultUncertaintyDays is used as the spread when there are too few cycles to
+	// compute a standard deviation.
+	defaultUncertaintyDays = 2
+	// perimenopauseUncertaintyDays is the least spread given around predictions in
+	// perimenopause, when cycles grow irregular.
+	perimenopauseUncertaintyDays = 7
+	// peakFertileDays is the number of days up to and including ovulation when
+	// conception is most likely.
+	peakFertileDays = 3
+)
+
+const (
+	PredictionSourceHistory  = "history"
+	PredictionSourceSettings = "settings"
+	PredictionSourceDefault  = "default"
+)
+
+// CycleHistory is one logged cycle together with the number of days marked as
+// period days.
+type CycleHistory struct {
+	StartDate              time.Time
+	CycleLength            int
+	PeriodLength           int
+	PeriodDays             int
+	ConfirmedOvulationDate *time.Time
+}
+
+type CycleStats struct {
+	Source              string  `json:"source"`
+	CyclesUsed          int     `json:"cycles_used"`
+	AverageCycleLength  float64 `json:"average_cycle_length"`
+	MedianCycleLength   float64 `json:"median_cycle_length"`
+	CycleLengthStdDev   float64 `json:"cycle_length_std_dev"`
+	AveragePeriodLength float64 `json:"average_period_length"`
+	MedianPeriodLength  float64 `json:"median_period_length"`
+	LutealPhaseLength   float64 `json:"luteal_phase_length"`
+}
+
+type PeriodPrediction struct {
+	StartDate     time.Time `json:"start_date"`
+	EndDate       time.Time `json:"end_date"`
+	EarliestStart time.Time `json:"earliest_start"`
+	LatestStart   time.Time `json:"latest_start"`
+	// Ovulation and the fertile window are left out in modes without regular
+	// ovulation; the peak days are only given when trying to conceive.
+	OvulationDate    *time.Time `json:"ovulation_date,omitempty"`
+	FertileStart     *time.Time `json:"fertile_start,omitempty"`
+	FertileEnd       *time.Time `json:"fertile_end,omitempty"`
+	PeakFertileStart *time.Time `json:"peak_fertile_start,omitempty"`
+	PeakFertileEnd   *time.Time `json:"peak_fertile_end,omitempty"`
+}
+
+type PeriodPredictions struct {
+	Mode        string             `json:"tracking_mode"`
+	Pregnancy   *Pregnancy         `json:"pregnancy,omitempty"`
+	Stats       CycleStats         `json:"stats"`
+	Predictions []PeriodPrediction `json:"predictions"`
+}
+
+// GetCycleHistory() returns the latest cycles of a user, newest first.
+func (m *UserPeriodModel) GetCycleHistory(userID string, limit int) ([]CycleHistory, error) {
+	query := `SELECT mc.start_date, mc.cycle_length, mc.period_length,
+	COUNT(cd.id) FILTER (WHERE cd.is_period), mc.confirmed_ovulation_date
+	FROM menstrual_cycles mc
+	LEFT JOIN cycles_days cd ON cd.cycle_id = mc.id
+	WHERE mc.user_id = $1
+	GROUP BY mc.id
+	ORDER BY mc.start_date DESC
+	LIMIT $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	history := []CycleHistory{}
+	for rows.Next() {
+		var cycle CycleHistory
+		err := rows.Scan(&cycle.StartDate, &cycle.CycleLength, &cycle.PeriodLength, &cycle.PeriodDays, &cycle.ConfirmedOvulationDate)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, cycle)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// GetPredictions() predicts the next count periods of a user from their cycle
+// history, falling back to their menstruation settings and then to a textbook cycle.
+func (m *UserPeriodModel) GetPredictions(userID string, settings *Menses, mode *TrackingMode, count int, now time.Time) (*PeriodPredictions, error) {
+	history, err := m.GetCycleHistory(userID, predictionHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	predictions := PredictPeriods(history, settings, mode.Mode, count, now)
+	predictions.Pregnancy = mode.Pregnancy(now)
+	return predictions, nil
+}
+
+// ComputeCycleStats() derives cycle and period lengths from history given newest
+// first. Cycle lengths come from the gap between consecutive start dates where
+// there is one, period lengths from the days marked as period days, and the luteal
+// phase from confirmed ovulations followed by a logged period.
+func ComputeCycleStats(history []CycleHistory, settings *Menses) CycleStats {
+	var cycleLengths, periodLengths, lutealLengths []float64
+	for i, cycle := range history {
+		length := observedCycleLength(history, i)
+		if length > 0 {
+			cycleLengths = append(cycleLengths, float64(length))
+		}
+		periodLength := cycle.PeriodDays
+		if periodLength == 0 {
+			periodLength = cycle.PeriodLength
+		}
+		if periodLength > 0 {
+			periodLengths = append(periodLengths, float64(periodLength))
+		}
+		if i > 0 && cycle.ConfirmedOvulationDate != nil {
+			luteal := int(TruncateToDay(history[i-1].StartDate).Sub(TruncateToDay(*cycle.ConfirmedOvulationDate)).Hours() / 24)
+			if luteal >= minLutealPhaseLength && luteal <= maxLutealPhaseLength {
+				lutealLengths = append(lutealLengths, float64(luteal))
+			}
+		}
+	}
+
+	if len(cycleLengths) > 0 {
+		stats := CycleStats{
+			Source:             PredictionSourceHistory,
+			CyclesUsed:         len(history),
+			AverageCycleLength: mean(cycleLengths),
+			MedianCycleLength:  median(cycleLengths),
+			CycleLengthStdDev:  stdDev(cycleLengths),
+			LutealPhaseLength:  lutealPhaseLength,
+		}
+		if len(lutealLengths) > 0 {
+			stats.LutealPhaseLength = median(lutealLengths)
+		}
+		if len(periodLengths) > 0 {
+			stats.AveragePeriodLength = mean(periodLengths)
+			stats.MedianPeriodLength = median(periodLengths)
+		} else {
+			stats.AveragePeriodLength = DefaultPeriodLength
+			stats.MedianPeriodLength = DefaultPeriodLength
+		}
+		return stats
+	}
+
+	stats := CycleStats{
+		Source:              PredictionSourceDefault,
+		AverageCycleLength:  DefaultCycleLength,
+		MedianCycleLength:   DefaultCycleLength,
+		AveragePeriodLength: DefaultPeriodLength,
+		MedianPeriodLength:  DefaultPeriodLength,
+		LutealPhaseLength:   lutealPhaseLength,
+	}
+	if settings != nil && settings.Cycle_len > 0 {
+		stats.Source = PredictionSourceSettings
+		stats.AverageCycleLength = float64(settings.Cycle_len)
+		stats.MedianCycleLength = float64(settings.Cycle_len)
+		if settings.Period_len > 0 {
+			stats.AveragePeriodLength = float64(settings.Period_len)
+			stats.MedianPeriodLength = float64(settings.Period_len)
+		}
+	}
+	return stats
+}
+
+// observedCycleLength() is the length of history[i] measured up to the start of the
+// next logged cycle, or the recorded length when there is no plausible next cycle.
+func observedCycleLength(history []CycleHistory, i int) int {
+	if i > 0 {
+		gap := int(history[i-1].StartDate.Sub(history[i].StartDate).Hours() / 24)
+		if gap >= minObservedCycleLength && gap <= maxObservedCycleLength {
+			return gap
+		}
+	}
+	return history[i].CycleLength
+}
+
+// PredictPeriods() projects count periods forward from the latest logged cycle,
+// using the median lengths so that a single odd cycle does not skew them. Fertile
+// windows use the user's own luteal phase once ovulation has been confirmed. The
+// range around each start date widens the further ahead the prediction is, and is
+// wider still in perimenopause. Nothing is predicted in pregnancy or menopause, or
+// before the first cycle is logged.
+func PredictPeriods(history []CycleHistory, settings *Menses, mode string, count int, now time.Time) *PeriodPredictions {
+	stats := ComputeCycleStats(history, settings)
+	if !predictsPeriods(mode) {
+		return &PeriodPredictions{Mode: mode, Stats: stats, Predictions: []PeriodPrediction{}}
+	}
+	cycleLength := int(math.Round(stats.MedianCycleLength))
+	periodLength := int(math.Round(stats.MedianPeriodLength))
+	lutealLength := int(math.Round(stats.LutealPhaseLength))
+	if periodLength >= cycleLength {
+		periodLength = cycleLength - 1
+	}
+
+	// Without a logged cycle there is nothing to project the next period from.
+	next, ok := expectedNextPeriod(history, cycleLength)
+	if !ok {
+		return &PeriodPredictions{Mode: mode, Stats: stats, Predictions: []PeriodPrediction{}}
+	}
+	// Roll forward over cycles that were never logged.
+	today := TruncateToDay(now)
+	for next.Before(today) {
+		next = next.AddDate(0, 0, cycleLength)
+	}
+
+	spread := stats.CycleLengthStdDev
+	if stats.CyclesUsed < 2 {
+		spread = defaultUncertaintyDays
+	}
+	if mode == ModePerimenopause {
+		spread = math.Max(2*spread, perimenopauseUncertaintyDays)
+	}
+
+	predictions := make([]PeriodPrediction, 0, count)
+	for i := 0; i < count; i++ {
+		start := next.AddDate(0, 0, i*cycleLength)
+		uncertainty := int(math.Ceil(spread * math.Sqrt(float64(i+1))))
+		prediction := PeriodPrediction{
+			StartDate:     start,
+			EndDate:       start.AddDate(0, 0, periodLength-1),
+			EarliestStart: start.AddDate(0, 0, -uncertainty),
+			LatestStart:   start.AddDate(0, 0, uncertainty),
+		}
+		if estimatesOvulation(mode) {
+			ovulation := OvulationDate(start, cycleLength, periodLength, lutealLength)
+			fertileStart := ovulation.AddDate(0, 0, -fertileWindowBefore)
+			fertileEnd := ovulation.AddDate(0, 0, 1)
+			prediction.OvulationDate = &ovulation
+			prediction.FertileStart = &fertileStart
+			prediction.FertileEnd = &fertileEnd
+			if mode == ModeTryingToConceive {
+				peakStart := ovulation.AddDate(0, 0, -peakFertileDays+1)
+				prediction.PeakFertileStart = &peakStart
+				prediction.PeakFertileEnd = &ovulation
+			}
+		}
+		predictions = append(predictions, prediction)
+	}
+	return &PeriodPredictions{Mode: mode, Stats: stats, Predictions: predictions}
+}
+
+// GetExpectedNextPeriod() returns the day the period after the latest logged cycle
+// should start. Unlike the predictions it does not skip ahead once that day has
+// passed, so it tells how late a period is. It reports false when no cycle was logged.
+func (m *UserPeriodModel) GetExpectedNextPeriod(userID string, settings *Menses) (time.Time, bool, error) {
+	history, err := m.GetCycleHistory(userID, predictionHistoryLimit)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	stats := ComputeCycleStats(history, settings)
+	expected, ok := expectedNextPeriod(history, int(math.Round(stats.MedianCycleLength)))
+	return expected, ok, nil
+}
+
+func expectedNextPeriod(history []CycleHistory, cycleLength int) (time.Time, bool) {
+	if len(history) == 0 {
+		return time.Time{}, false
+	}
+	return TruncateToDay(history[0].StartDate).AddDate(0, 0, cycleLength), true
+}
+
+// OvulationDate() estimates ovulation a luteal phase before the next period, but
+// never during the period itself.
+func OvulationDate(start time.Time, cycleLength, periodLength, lutealLength int) time.Time {
+	return start.AddDate(0, 0, ovulationDay(cycleLength, periodLength, lutealLength))
+}
+
+// ovulationDay() is the zero-based day of the cycle on which ovulation is expected.
+func ovulationDay(cycleLength, periodLength, lutealLength int) int {
+	day := cycleLength - lutealLength
+	if day < periodLength {
+		day = periodLength
+	}
+	return day
+}
+
+// TruncateToDay() returns midnight UTC of the calendar day of t.
+func TruncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func stdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	avg := mean(values)
+	var sum float64
+	for _, value := range values {
+		sum += (value - avg) * (value - avg)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// Cycles shorter or longer than this are outside the usual adult range.
+	regularCycleMin = 21
+	regularCycleMax = 35
+	// irregularCycleSpread is the largest difference between the shortest and the
+	// longest cycle still considered regular.
+	irregularCycleSpread = 7
+	// missedPeriodGrace is how late a period may be before it is flagged as missed.
+	missedPeriodGrace = 7
+	// longBleedingDays is the period length above which bleeding is unusually long.
+	longBleedingDays = 7
+	// periodTrendThreshold is the change in period length per cycle, in days, below
+	// which the trend is reported as stable.
+	periodTrendThreshold = 0.25
+)
+
+const (
+	TrendIncreasing = "increasing"
+	TrendDecreasing = "decreasing"
+	TrendStable     = "stable"
+)
+
+type PeriodLengthPoint struct {
+	StartDate    time.Time `json:"start_date"`
+	PeriodLength int       `json:"period_length"`
+}
+
+type CycleDayAverage struct {
+	Day         int     `json:"day"`
+	AverageFlow float64 `json:"average_flow"`
+	AveragePain float64 `json:"average_pain"`
+	Samples     int     `json:"samples"`
+}
+
+type CycleFlags struct {
+	IrregularCycles bool `json:"irregular_cycles"`
+	MissedPeriod    bool `json:"missed_period"`
+	LongBleeding    bool `json:"long_bleeding"`
+}
+
+type CycleStatistics struct {
+	CyclesAnalyzed      int                 `json:"cycles_analyzed"`
+	AverageCycleLength  float64             `json:"average_cycle_length"`
+	CycleLengthStdDev   float64             `json:"cycle_length_std_dev"`
+	ShortestCycle       int                 `json:"shortest_cycle"`
+	LongestCycle        int                 `json:"longest_cycle"`
+	AveragePeriodLength float64             `json:"average_period_length"`
+	PeriodLengthTrend   string              `json:"period_length_trend"`
+	PeriodLengths       []PeriodLengthPoint `json:"period_lengths"`
+	DayAverages         []CycleDayAverage   `json:"day_averages"`
+	DaysSinceLastPeriod int                 `json:"days_since_last_period"`
+	LongBleedingCycles  []time.Time         `json:"long_bleeding_cycles"`
+	Flags               CycleFlags          `json:"flags"`
+}
+
+// GetCycleStatistics() loads every cycle of a user with its days and summarises them.
+func (m *UserPeriodModel) GetCycleStatistics(userID, mode string, now time.Time) (*CycleStatistics, error) {
+	cycles, err := m.GetMenstrualCycles(userID)
+	if err != nil {
+		return nil, err
+	}
+	// Load the days of every cycle at once rather than one query per cycle.
+	userDays, err := m.GetCycleDaysSince(userID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	days := make(map[string][]CycleDay, len(cycles))
+	for _, day := range userDays {
+		days[day.CycleID] = append(days[day.CycleID], day)
+	}
+	return ComputeCycleStatistics(cycles, days, mode, now), nil
+}
+
+// ComputeCycleStatistics() summarises cycles given newest first, as returned by
+// GetMenstrualCycles(), together with their days keyed by cycle id. A late period
+// is only flagged as missed in cycle mode, where periods are expected to be regular.
+func ComputeCycleStatistics(cycles []MenstrualCycle, days map[string][]CycleDay, mode string, now time.Time) *CycleStatistics {
+	stats := &CycleStatistics{
+		CyclesAnalyzed:     len(cycles),
+		PeriodLengthTrend:  TrendStable,
+		PeriodLengths:      []PeriodLengthPoint{},
+		DayAverages:        []CycleDayAverage{},
+		LongBleedingCycles: []time.Time{},
+	}
+	if len(cycles) == 0 {
+		return stats
+	}
+
+	history := make([]CycleHistory, 0, len(cycles))
+	for _, cycle := range cycles {
+		entry := CycleHistory{StartDate: cycle.StartDate, CycleLength: cycle.CycleLength, PeriodLength: cycle.PeriodLength}
+		for _, day := range days[cycle.ID] {
+			if day.IsPeriod {
+				entry.PeriodDays++
+			}
+		}
+		history = append(history, entry)
+	}
+	summary := ComputeCycleStats(history, nil)
+	stats.AverageCycleLength = summary.AverageCycleLength
+	stats.CycleLengthStdDev = summary.CycleLengthStdDev
+	stats.AveragePeriodLength = summary.AveragePeriodLength
+
+	// Walk oldest first so the period lengths read as a time series.
+	var periodLengths []float64
+	for i := len(history) - 1; i >= 0; i-- {
+		cycle := history[i]
+		length := observedCycleLength(history, i)
+		if stats.ShortestCycle == 0 || length < stats.ShortestCycle {
+			stats.ShortestCycle = length
+		}
+		if length > stats.LongestCycle {
+			stats.LongestCycle = length
+		}
+
+		periodLength := cycle.PeriodDays
+		if periodLength == 0 {
+			periodLength = cycle.PeriodLength
+		}
+		stats.PeriodLengths = append(stats.PeriodLengths, PeriodLengthPoint{StartDate: cycle.StartDate, PeriodLength: periodLength})
+		periodLengths = append(periodLengths, float64(periodLength))
+		if periodLength > longBleedingDays {
+			stats.LongBleedingCycles = append(stats.LongBleedingCycles, cycle.StartDate)
+		}
+	}
+	if slope := trendSlope(periodLengths); slope > periodTrendThreshold {
+		stats.PeriodLengthTrend = TrendIncreasing
+	} else if slope < -periodTrendThreshold {
+		stats.PeriodLengthTrend = TrendDecreasing
+	}
+
+	stats.DayAverages = cycleDayAverages(cycles, days)
+
+	stats.DaysSinceLastPeriod = int(TruncateToDay(now).Sub(TruncateToDay(cycles[0].StartDate)).Hours() / 24)
+	expected := int(math.Round(summary.MedianCycleLength))
+
+	stats.Flags.IrregularCycles = len(cycles) >= 2 &&
+		(stats.LongestCycle-stats.ShortestCycle > irregularCycleSpread ||
+			stats.ShortestCycle < regularCycleMin || stats.LongestCycle > regularCycleMax)
+	stats.Flags.MissedPeriod = mode == ModeCycle && stats.DaysSinceLastPeriod > expected+missedPeriodGrace
+	stats.Flags.LongBleeding = len(stats.LongBleedingCycles) > 0
+	return stats
+}
+
+// cycleDayAverages() averages flow and pain by day of the cycle over the days on
+// which either was logged.
+func cycleDayAverages(cycles []MenstrualCycle, days map[string][]CycleDay) []CycleDayAverage {
+	averages := []CycleDayAverage{}
+	for _, cycle := range cycles {
+		for _, day := range days[cycle.ID] {
+			if day.Flow == 0 && day.Pain == 0 {
+				continue
+			}
+			index := int(TruncateToDay(day.Date).Sub(TruncateToDay(cycle.StartDate)).Hours() / 24)
+			if index < 0 {
+				continue
+			}
+			for len(averages) <= index {
+				averages = append(averages, CycleDayAverage{Day: len(averages) + 1})
+			}
+			averages[index].AverageFlow += float64(day.Flow)
+			averages[index].AveragePain += float64(day.Pain)
+			averages[index].Samples++
+		}
+	}
+	result := []CycleDayAverage{}
+	for _, average := range averages {
+		if average.Samples == 0 {
+			continue
+		}
+		average.AverageFlow /= float64(average.Samples)
+		average.AveragePain /= float64(average.Samples)
+		result = append(result, average)
+	}
+	return result
+}
+
+// trendSlope() is the least squares slope of values against their position.
+func trendSlope(values []float64) float64 {
+	n := float64(len(values))
+	if n < 2 {
+		return 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, value := range values {
+		x := float64(i)
+		sumX += x
+		sumY += value
+		sumXY += x * value
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
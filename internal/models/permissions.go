@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	PermissionResourcesWrite = "resources:write"
+	PermissionMetricsView    = "metrics:view"
+	PermissionUsersManage    = "users:manage"
+
+	RoleAdmin = "admin"
+)
+
+// Permissions holds permission codes such as "resources:write".
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+type Role struct {
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForUser() returns the permissions granted to the user through their roles.
+func (m PermissionModel) GetAllForUser(userID string) (Permissions, error) {
+	query := `
+	SELECT DISTINCT permissions.code
+	FROM permissions
+	INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+	INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+	WHERE users_roles.user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	permissions := Permissions{}
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (m PermissionModel) GetRoles() ([]*Role, error) {
+	query := `
+	SELECT roles.name, COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+	FROM roles
+	LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+	LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+	GROUP BY roles.name
+	ORDER BY roles.name`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(&role.Name, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (m PermissionModel) GetRolesForUser(userID string) ([]string, error) {
+	query := `
+	SELECT roles.name FROM roles
+	INNER JOIN users_roles ON users_roles.role_id = roles.id
+	WHERE users_roles.user_id = $1
+	ORDER BY roles.name`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// SetRolesForUser() replaces the user's roles. It returns ErrRecordNotFound if a
+// role doesn't exist. users.isAdmin is kept in step with the admin role.
+func (m PermissionModel) SetRolesForUser(userID string, roles []string, actorID, actorIP string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var found int
+	err = tx.QueryRowContext(ctx, ` SELECT COUNT(*) FROM roles WHERE name = ANY($1)`, pq.Array(roles)).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != len(roles) {
+		return ErrRecordNotFound
+	}
+	_, err = tx.ExecContext(ctx, ` DELETE FROM users_roles WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO users_roles (user_id, role_id)
+	SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)`, userID, pq.Array(roles))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, ` UPDATE users SET isAdmin = $2 WHERE id = $1`, userID, slices.Contains(roles, RoleAdmin))
+	if err != nil {
+		return err
+	}
+	err = insertActorAuditLog(ctx, tx, userID, AuditRolesChanged, actorIP, actorID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	PhaseMenstrual  = "menstrual"
+	PhaseFollicular = "follicular"
+	PhaseOvulatory  = "ovulatory"
+	PhaseLuteal     = "luteal"
+)
+
+// topPhaseSymptoms is how many symptoms are listed for each phase.
+const topPhaseSymptoms = 5
+
+type PhaseSymptom struct {
+	SymptomID   int     `json:"symptom_id"`
+	Name        string  `json:"name"`
+	AvgSeverity float64 `json:"average_severity"`
+	Occurrences int     `json:"occurrences"`
+}
+
+type PhaseSymptoms struct {
+	Phase       string         `json:"phase"`
+	AvgSeverity float64        `json:"average_severity"`
+	Occurrences int            `json:"occurrences"`
+	TopSymptoms []PhaseSymptom `json:"top_symptoms"`
+}
+
+// GetSymptomPhaseOccurrences retrieves the average severity of each symptom per cycle
+// phase over the last days, matching symptom logs to cycle days by date. Should two
+// cycles still have a day on the same date, the one of the later cycle is used.
+func (m AnalyticsModel) GetSymptomPhaseOccurrences(userID string, days int) ([]PhaseSymptoms, error) {
+	query := fmt.Sprintf(`
+	SELECT
+		CASE
+			WHEN cd.is_period THEN '%s'
+			WHEN cd.is_ovulation OR cd.is_fertile THEN '%s'
+			WHEN cd.is_luteal THEN '%s'
+			ELSE '%s'
+		END AS phase,
+		symptoms.id,
+		symptoms.name,
+		AVG((usm.morning_severity + usm.afternoon_severity + usm.night_severity) / 3) AS average_severity,
+		COUNT(*) AS occurrences
+	FROM
+		user_symptoms_metric usm
+		INNER JOIN (
+			SELECT DISTINCT ON (cycles_days.date) cycles_days.*
+			FROM cycles_days
+			INNER JOIN menstrual_cycles mc ON mc.id = cycles_days.cycle_id
+			WHERE cycles_days.user_id = $1
+			ORDER BY cycles_days.date, mc.start_date DESC
+		) cd ON cd.date = usm.date
+		INNER JOIN symptoms ON symptoms.id = usm.symptoms_id
+	WHERE
+		usm.user_id = $1
+		AND usm.date >= CURRENT_DATE - INTERVAL '%d days'
+	GROUP BY
+		phase, symptoms.id, symptoms.name
+	ORDER BY
+		phase, average_severity DESC, occurrences DESC;
+`, PhaseMenstrual, PhaseOvulatory, PhaseLuteal, PhaseFollicular, days)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	phases := []PhaseSymptoms{
+		{Phase: PhaseMenstrual},
+		{Phase: PhaseFollicular},
+		{Phase: PhaseOvulatory},
+		{Phase: PhaseLuteal},
+	}
+	index := map[string]int{}
+	for i, phase := range phases {
+		index[phase.Phase] = i
+		phases[i].TopSymptoms = []PhaseSymptom{}
+	}
+	sums := make([]float64, len(phases))
+	for rows.Next() {
+		var phase string
+		var symptom PhaseSymptom
+		err := rows.Scan(&phase, &symptom.SymptomID, &symptom.Name, &symptom.AvgSeverity, &symptom.Occurrences)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		i := index[phase]
+		sums[i] += symptom.AvgSeverity * float64(symptom.Occurrences)
+		phases[i].Occurrences += symptom.Occurrences
+		if len(phases[i].TopSymptoms) < topPhaseSymptoms {
+			symptom.AvgSeverity = Round(symptom.AvgSeverity)
+			phases[i].TopSymptoms = append(phases[i].TopSymptoms, symptom)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range phases {
+		if phases[i].Occurrences > 0 {
+			phases[i].AvgSeverity = Round(sums[i] / float64(phases[i].Occurrences))
+		}
+	}
+	return phases, nil
+}
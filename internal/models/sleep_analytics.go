@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SleepSummary totals the sleep of a period, night sleep and naps apart. Averages
+// are per night slept, so days without a night entry don't pull them down.
+type SleepSummary struct {
+	NightMinutes        int     `json:"night_minutes"`
+	NapMinutes          int     `json:"nap_minutes"`
+	TotalMinutes        int     `json:"total_minutes"`
+	Nights              int     `json:"nights"`
+	Naps                int     `json:"naps"`
+	AverageNightMinutes int     `json:"average_night_minutes"`
+	AverageSeverity     float64 `json:"average_severity"`
+}
+
+// sleepSummaryQuery sums the sleep of each period, given as an expression of the
+// date, of a user. Entries whose times couldn't be migrated are left out.
+const sleepSummaryQuery = `
+	SELECT
+		%s AS period,
+		COALESCE(SUM(EXTRACT(EPOCH FROM woke_at - slept_at) / 60) FILTER (WHERE is_night), 0) AS night_minutes,
+		COALESCE(SUM(EXTRACT(EPOCH FROM woke_at - slept_at) / 60) FILTER (WHERE NOT is_night), 0) AS nap_minutes,
+		COUNT(DISTINCT date) FILTER (WHERE is_night) AS nights,
+		COUNT(*) FILTER (WHERE NOT is_night) AS naps,
+		COALESCE(AVG(severity), 0) AS average_severity
+	FROM
+		user_sleep_metric
+	WHERE
+		user_id = $1
+		AND slept_at IS NOT NULL
+		AND %s
+	GROUP BY
+		period
+	ORDER BY
+		period;
+`
+
+// GetSleepDaysSummaries sums the sleep of the last days per day of the week.
+func (m AnalyticsModel) GetSleepDaysSummaries(userID string, days int) (map[int]SleepSummary, error) {
+	query := fmt.Sprintf(sleepSummaryQuery, "EXTRACT(DOW FROM date)",
+		fmt.Sprintf("date >= CURRENT_DATE - INTERVAL '%d days'", days))
+	return m.getSleepSummaries(query, []any{userID}, 0, 6)
+}
+
+// GetMonthSleepSummaries sums the sleep of a month per week of the month.
+func (m AnalyticsModel) GetMonthSleepSummaries(userID string, month int) (map[int]SleepSummary, error) {
+	query := fmt.Sprintf(sleepSummaryQuery, "(EXTRACT(WEEK FROM date) - EXTRACT(WEEK FROM date_trunc('month', date)) + 1)",
+		"EXTRACT(MONTH FROM date) = $2")
+	return m.getSleepSummaries(query, []any{userID, month}, 1, 5)
+}
+
+// GetYearSleepSummaries sums the sleep of a year per month.
+func (m AnalyticsModel) GetYearSleepSummaries(userID string, year int) (map[int]SleepSummary, error) {
+	query := fmt.Sprintf(sleepSummaryQuery, "EXTRACT(MONTH FROM date)", "EXTRACT(YEAR FROM date) = $2")
+	return m.getSleepSummaries(query, []any{userID, year}, 1, 12)
+}
+
+// getSleepSummaries runs a sleepSummaryQuery, giving every period from first to last
+// a summary, empty when nothing was logged.
+func (m AnalyticsModel) getSleepSummaries(query string, args []any, first, last int) (map[int]SleepSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	defer rows.Close()
+
+	summaries := make(map[int]SleepSummary)
+	for rows.Next() {
+		var period int
+		var nightMinutes, napMinutes float64
+		var summary SleepSummary
+		err := rows.Scan(&period, &nightMinutes, &napMinutes, &summary.Nights, &summary.Naps, &summary.AverageSeverity)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %v", err)
+		}
+		summary.NightMinutes = int(nightMinutes)
+		summary.NapMinutes = int(napMinutes)
+		summary.TotalMinutes = summary.NightMinutes + summary.NapMinutes
+		if summary.Nights > 0 {
+			summary.AverageNightMinutes = summary.NightMinutes / summary.Nights
+		}
+		summary.AverageSeverity = Round(summary.AverageSeverity)
+		summaries[period] = summary
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := first; i <= last; i++ {
+		if _, exists := summaries[i]; !exists {
+			summaries[i] = SleepSummary{}
+		}
+	}
+
+	return summaries, nil
+}
@@ -7,16 +7,75 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/olagookundavid/itoju/internal/validator"
 )
 
+// maxSleep is the longest a single sleep entry may last.
+const maxSleep = 24 * time.Hour
+
+// SleepMetric is a night's sleep or a nap. Date is the day the sleep ended, so a
+// night crossing midnight belongs to the morning after. TimeSlept and TimeWokeUp
+// are the times of day of SleptAt and WokeAt.
 type SleepMetric struct {
-	ID         int       `json:"id"`
-	IsNight    bool      `json:"is_night"`
-	TimeSlept  string    `json:"time_slept"`
-	TimeWokeUp string    `json:"time_woke_up"`
-	Tags       []string  `json:"tags"`
-	Date       time.Time `json:"date"`
-	Severity   float64   `json:"severity"`
+	ID              int        `json:"id"`
+	IsNight         bool       `json:"is_night"`
+	TimeSlept       string     `json:"time_slept"`
+	TimeWokeUp      string     `json:"time_woke_up"`
+	SleptAt         *time.Time `json:"slept_at"`
+	WokeAt          *time.Time `json:"woke_at"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Tags            []string   `json:"tags"`
+	Date            time.Time  `json:"date"`
+	Severity        float64    `json:"severity"`
+}
+
+// ReadSleepTimes() sets SleptAt and WokeAt from what the apps send for them: full
+// timestamps, or times of day. A time of day for waking up falls on the date of the
+// entry, and a time of day for falling asleep that isn't before waking up falls on
+// the day before, the sleep having crossed midnight.
+func ReadSleepTimes(v *validator.Validator, sleepMetric *SleepMetric, timeSlept, timeWokeUp string) {
+	wokeAt, _, ok := parseTimeOn(sleepMetric.Date, timeWokeUp)
+	if !ok {
+		v.AddError("time_woke_up", "must be a time of day such as 07:30 or a timestamp")
+		return
+	}
+	sleepMetric.WokeAt = &wokeAt
+	sleptAt, clock, ok := parseTimeOn(wokeAt, timeSlept)
+	if !ok {
+		v.AddError("time_slept", "must be a time of day such as 22:30 or a timestamp")
+		return
+	}
+	if clock && !sleptAt.Before(wokeAt) {
+		sleptAt = sleptAt.AddDate(0, 0, -1)
+	}
+	sleepMetric.SleptAt = &sleptAt
+	sleepMetric.setDuration()
+}
+
+func ValidateSleepMetric(v *validator.Validator, sleepMetric *SleepMetric) {
+	// Both times may be missing, as for entries whose times couldn't be migrated or
+	// that were logged without them, but not just one.
+	v.Check(sleepMetric.SleptAt != nil || sleepMetric.WokeAt == nil, "time_slept", "must be provided")
+	v.Check(sleepMetric.WokeAt != nil || sleepMetric.SleptAt == nil, "time_woke_up", "must be provided")
+	if sleepMetric.SleptAt != nil && sleepMetric.WokeAt != nil {
+		duration := sleepMetric.WokeAt.Sub(*sleepMetric.SleptAt)
+		v.Check(duration > 0, "time_woke_up", "must be after time_slept")
+		v.Check(duration <= maxSleep, "time_slept", "must not be more than 24 hours before time_woke_up")
+	}
+	v.Check(sleepMetric.Severity >= 0 && sleepMetric.Severity <= 1, "severity", "must be between 0 and 1")
+}
+
+// setDuration() derives the times of day and the duration from SleptAt and WokeAt.
+// Entries whose times couldn't be read when they were migrated have neither.
+func (s *SleepMetric) setDuration() {
+	if s.SleptAt == nil || s.WokeAt == nil {
+		return
+	}
+	sleptAt, wokeAt := s.SleptAt.UTC(), s.WokeAt.UTC()
+	s.SleptAt, s.WokeAt = &sleptAt, &wokeAt
+	s.TimeSlept = sleptAt.Format("15:04")
+	s.TimeWokeUp = wokeAt.Format("15:04")
+	s.DurationMinutes = int(wokeAt.Sub(sleptAt).Minutes())
 }
 
 type SleepMetricModel struct {
@@ -26,7 +85,7 @@ type SleepMetricModel struct {
 func (m SleepMetricModel) GetUserSleepMetrics(userId string, date time.Time) ([]*SleepMetric, error) {
 
 	query := `
-	SELECT usm.id, usm.is_night, usm.time_slept, usm.time_woke_up, usm.tags, usm.date, usm.severity
+	SELECT usm.id, usm.is_night, usm.slept_at, usm.woke_at, usm.tags, usm.date, usm.severity
     FROM user_sleep_metric usm
     WHERE usm.user_id = $1 AND usm.date = $2
     `
@@ -40,10 +99,11 @@ func (m SleepMetricModel) GetUserSleepMetrics(userId string, date time.Time) ([]
 	sleepsMetrics := []*SleepMetric{}
 	for rows.Next() {
 		var sleepMetric SleepMetric
-		err := rows.Scan(&sleepMetric.ID, &sleepMetric.IsNight, &sleepMetric.TimeSlept, &sleepMetric.TimeWokeUp, pq.Array(&sleepMetric.Tags), &sleepMetric.Date, &sleepMetric.Severity)
+		err := rows.Scan(&sleepMetric.ID, &sleepMetric.IsNight, &sleepMetric.SleptAt, &sleepMetric.WokeAt, pq.Array(&sleepMetric.Tags), &sleepMetric.Date, &sleepMetric.Severity)
 		if err != nil {
 			return nil, err
 		}
+		sleepMetric.setDuration()
 
 		sleepsMetrics = append(sleepsMetrics, &sleepMetric)
 	}
@@ -55,7 +115,7 @@ func (m SleepMetricModel) GetUserSleepMetrics(userId string, date time.Time) ([]
 
 func (m SleepMetricModel) GetUserSleepMetric(userId string, id int64) (*SleepMetric, error) {
 	query := `
-    SELECT usm.id, usm.is_night, usm.time_slept, usm.time_woke_up, usm.tags, usm.date, usm.severity
+    SELECT usm.id, usm.is_night, usm.slept_at, usm.woke_at, usm.tags, usm.date, usm.severity
     FROM user_sleep_metric usm
     WHERE usm.user_id = $1 AND usm.id = $2
     `
@@ -64,37 +124,42 @@ func (m SleepMetricModel) GetUserSleepMetric(userId string, id int64) (*SleepMet
 	row := m.DB.QueryRowContext(ctx, query, userId, id)
 
 	var sleepMetric SleepMetric
-	err := row.Scan(&sleepMetric.ID, &sleepMetric.IsNight, &sleepMetric.TimeSlept, &sleepMetric.TimeWokeUp, pq.Array(&sleepMetric.Tags), &sleepMetric.Date, &sleepMetric.Severity)
+	err := row.Scan(&sleepMetric.ID, &sleepMetric.IsNight, &sleepMetric.SleptAt, &sleepMetric.WokeAt, pq.Array(&sleepMetric.Tags), &sleepMetric.Date, &sleepMetric.Severity)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
 		}
 		return nil, err
 	}
+	sleepMetric.setDuration()
 	return &sleepMetric, nil
 }
 
 func (m SleepMetricModel) InsertSleepMetric(userID string, sleepMetric *SleepMetric) error {
+	return insertSleepMetric(m.DB, userID, sleepMetric)
+}
+
+func (m SleepMetricModel) InsertSleepMetricTx(tx *sql.Tx, userID string, sleepMetric *SleepMetric) error {
+	return insertSleepMetric(tx, userID, sleepMetric)
+}
 
+func insertSleepMetric(db execer, userID string, sleepMetric *SleepMetric) error {
 	query := `
-	INSERT INTO user_sleep_metric (user_id, is_night, time_slept, time_woke_up, date, severity, tags)
+	INSERT INTO user_sleep_metric (user_id, is_night, slept_at, woke_at, date, severity, tags)
 	VALUES ($1, $2, $3, $4, $5, $6, $7) `
 
-	args := []any{userID, sleepMetric.IsNight, sleepMetric.TimeSlept, sleepMetric.TimeWokeUp, sleepMetric.Date, sleepMetric.Severity, pq.Array(sleepMetric.Tags)}
+	args := []any{userID, sleepMetric.IsNight, sleepMetric.SleptAt, sleepMetric.WokeAt, sleepMetric.Date, sleepMetric.Severity, pq.Array(sleepMetric.Tags)}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
 }
 
 func (m SleepMetricModel) UpdateSleepMetric(sleepMetric *SleepMetric) error {
 
-	query := ` UPDATE user_sleep_metric SET time_slept = $1, time_woke_up = $2, tags = $3, severity = $4 WHERE id = $5 AND is_night = $6; `
+	query := ` UPDATE user_sleep_metric SET slept_at = $1, woke_at = $2, tags = $3, severity = $4 WHERE id = $5 AND is_night = $6; `
 
-	args := []any{sleepMetric.TimeSlept, sleepMetric.TimeWokeUp, pq.Array(sleepMetric.Tags), sleepMetric.Severity, sleepMetric.ID, sleepMetric.IsNight}
+	args := []any{sleepMetric.SleptAt, sleepMetric.WokeAt, pq.Array(sleepMetric.Tags), sleepMetric.Severity, sleepMetric.ID, sleepMetric.IsNight}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, args...)
@@ -81,6 +81,14 @@ func (m SmileysModel) GetUserSmileys(userID string) ([]*Smileys, error) {
 }
 
 func (m SmileysModel) InsertUserSmileys(userID string, smiley Smileys, date time.Time) error {
+	return insertUserSmileys(m.DB, userID, smiley, date)
+}
+
+func (m SmileysModel) InsertUserSmileysTx(tx *sql.Tx, userID string, smiley Smileys, date time.Time) error {
+	return insertUserSmileys(tx, userID, smiley, date)
+}
+
+func insertUserSmileys(db execer, userID string, smiley Smileys, date time.Time) error {
 	query := `
 	INSERT INTO user_smiley (user_id, smiley_id, granted_at, tags)
 	VALUES ($1, $2, $3, $4) `
@@ -88,17 +96,16 @@ func (m SmileysModel) InsertUserSmileys(userID string, smiley Smileys, date time
 	args := []any{userID, smiley.Id, date, pq.Array(smiley.Tags)}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "user_smiley_pkey"`:
-
 			return ErrRecordAlreadyExist
 		default:
 			return err
 		}
 	}
-	return err
+	return nil
 }
 
 func (m SmileysModel) GetUserSmileysCount(userID string, interval int) ([]*SmileysCount, *int, error) {
@@ -27,24 +27,33 @@ type SymsMetricModel struct {
 }
 
 func (m SymsMetricModel) CreateSymsMetric(userId string, symsMetric SymsMetric) error {
+	return createSymsMetric(m.DB, userId, symsMetric)
+}
+
+func (m SymsMetricModel) CreateSymsMetricTx(tx *sql.Tx, userId string, symsMetric SymsMetric) error {
+	return createSymsMetric(tx, userId, symsMetric)
+}
+
+// createSymsMetric() inserts a symptom metric including its severities, which are
+// zero for a new entry. symsMetric.Id is the symptom id.
+func createSymsMetric(db execer, userId string, symsMetric SymsMetric) error {
 	query := `
-	INSERT INTO user_symptoms_metric (user_id, symptoms_id, date)
-	VALUES ($1, $2, $3) `
+	INSERT INTO user_symptoms_metric (user_id, symptoms_id, date, morning_severity, afternoon_severity, night_severity)
+	VALUES ($1, $2, $3, $4, $5, $6) `
 
-	args := []any{userId, symsMetric.Id, symsMetric.Date}
+	args := []any{userId, symsMetric.Id, symsMetric.Date, symsMetric.MorningSeverity, symsMetric.AfternoonSeverity, symsMetric.NightSeverity}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "unique_user_symptom_date"`:
-
 			return ErrRecordAlreadyExist
 		default:
 			return err
 		}
 	}
-	return err
+	return nil
 }
 
 func (m SymsMetricModel) GetUserSymptomsMetric(userId string, date time.Time) ([]*SymsMetric, error) {
@@ -6,6 +6,8 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/olagookundavid/itoju/internal/validator"
@@ -15,6 +17,11 @@ const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
 	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	ScopeUnlock         = "unlock"
+	ScopeMFAPending     = "mfa-pending"
+	ScopeEmailChange    = "email-change"
+	ScopeCalendarFeed   = "calendar-feed"
 )
 
 type Token struct {
@@ -23,6 +30,20 @@ type Token struct {
 	UserID    string    `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	SessionID string    `json:"-"`
+	Device    string    `json:"-"`
+	IP        string    `json:"-"`
+}
+
+// Session describes one login: the refresh token and the access tokens issued from
+// it share a session id.
+type Session struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	Expiry    time.Time `json:"expiry"`
+	Current   bool      `json:"current"`
 }
 
 func generateToken(userID string, ttl time.Duration, scope string) (*Token, error) {
@@ -41,6 +62,17 @@ func generateToken(userID string, ttl time.Duration, scope string) (*Token, erro
 	token.Hash = hash[:]
 	return token, nil
 }
+
+// NewSessionID returns a random identifier for a new login session.
+func NewSessionID() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
+
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
@@ -59,10 +91,24 @@ func (m TokenModel) New(userID string, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewForSession() creates a token tied to a login session, recording the device and
+// ip address it was issued to.
+func (m TokenModel) NewForSession(userID, sessionID string, ttl time.Duration, scope, device, ip string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.SessionID = sessionID
+	token.Device = device
+	token.IP = ip
+	err = m.Insert(token)
+	return token, err
+}
+
 // Insert() adds the data for a specific token to the tokens table.
 func (m TokenModel) Insert(token *Token) error {
-	query := ` INSERT INTO tokens (hash, user_id, expiry, scope) VALUES ($1, $2, $3, $4)`
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	query := ` INSERT INTO tokens (hash, user_id, expiry, scope, session_id, device, ip) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)`
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.SessionID, token.Device, token.IP}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, args...)
@@ -78,6 +124,15 @@ func (m TokenModel) DeleteAllForUser(scope string, userID string) error {
 	return err
 }
 
+// DeleteAllScopesForUser() deletes every token of a user, whatever its scope.
+func (m TokenModel) DeleteAllScopesForUser(userID string) error {
+	query := ` DELETE FROM tokens WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
 func (m TokenModel) DeleteAllExpiredTokens() error {
 	query := ` DELETE FROM tokens WHERE tokens.expiry < NOW()`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -86,3 +141,91 @@ func (m TokenModel) DeleteAllExpiredTokens() error {
 
 	return err
 }
+
+// Consume() deletes an unexpired token and returns it. Because the lookup and the
+// delete are one statement, a token can only ever be consumed once.
+func (m TokenModel) Consume(scope, tokenPlaintext string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := ` DELETE FROM tokens WHERE hash = $1 AND scope = $2 AND expiry > $3
+	RETURNING user_id, expiry, COALESCE(session_id, ''), device, ip`
+	token := Token{Plaintext: tokenPlaintext, Hash: tokenHash[:], Scope: scope}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], scope, time.Now()).Scan(
+		&token.UserID,
+		&token.Expiry,
+		&token.SessionID,
+		&token.Device,
+		&token.IP)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &token, nil
+}
+
+// GetSessionsForUser() lists the active sessions of a user, one per refresh token.
+// The session the given token belongs to is flagged as the current one.
+func (m TokenModel) GetSessionsForUser(userID, currentTokenPlaintext string) ([]*Session, error) {
+	currentHash := sha256.Sum256([]byte(currentTokenPlaintext))
+	query := ` SELECT session_id, device, ip, created_at, expiry,
+	session_id = COALESCE((SELECT session_id FROM tokens WHERE hash = $3), '') AS current
+	FROM tokens
+	WHERE user_id = $1 AND scope = $2 AND session_id IS NOT NULL AND expiry > NOW()
+	ORDER BY created_at DESC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, ScopeRefresh, currentHash[:])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.Device, &session.IP, &session.CreatedAt, &session.Expiry, &session.Current)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteSession() deletes every token belonging to one session of a user.
+func (m TokenModel) DeleteSession(userID, sessionID string) error {
+	query := ` DELETE FROM tokens WHERE user_id = $1 AND session_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteSessionForToken() deletes the given token together with every other token
+// of its session. Tokens issued before sessions existed are deleted on their own.
+func (m TokenModel) DeleteSessionForToken(tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := ` DELETE FROM tokens WHERE hash = $1
+	OR session_id = (SELECT session_id FROM tokens WHERE hash = $1)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:])
+	return err
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+type TOTP struct {
+	UserID       string    `json:"-"`
+	Secret       string    `json:"-"`
+	Confirmed    bool      `json:"confirmed"`
+	LastUsedStep int64     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type TOTPModel struct {
+	DB *sql.DB
+}
+
+// GenerateRecoveryCodes returns n random single-use codes formatted as xxxxx-xxxxx.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		randomBytes := make([]byte, 7)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hash[:]
+}
+
+func (m TOTPModel) Get(userID string) (*TOTP, error) {
+	query := ` SELECT user_id, secret, confirmed, last_used_step, created_at FROM user_totp WHERE user_id = $1`
+	var totp TOTP
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.Confirmed,
+		&totp.LastUsedStep,
+		&totp.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &totp, nil
+}
+
+// IsEnabled() reports whether the user has a confirmed TOTP enrollment.
+func (m TOTPModel) IsEnabled(userID string) (bool, error) {
+	totp, err := m.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return totp.Confirmed, nil
+}
+
+// Enroll() stores a new unconfirmed secret, replacing any enrollment that was never
+// confirmed. A confirmed enrollment is left alone and ErrRecordAlreadyExist returned.
+func (m TOTPModel) Enroll(userID, secret string) error {
+	query := `
+	INSERT INTO user_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id)
+	DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+	WHERE NOT user_totp.confirmed`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordAlreadyExist
+	}
+	return nil
+}
+
+// UseStep() records a successfully verified time step. A step that is not newer than
+// the last one used is a replayed code and reported as ErrEditConflict.
+func (m TOTPModel) UseStep(userID string, step int64) error {
+	query := ` UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	return nil
+}
+
+// Confirm() enables the enrollment and replaces the user's recovery codes.
+func (m TOTPModel) Confirm(userID string, recoveryCodes []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = tx.ExecContext(ctx, ` UPDATE user_totp SET confirmed = TRUE WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	err = m.replaceRecoveryCodesTx(ctx, tx, userID, recoveryCodes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m TOTPModel) ReplaceRecoveryCodes(userID string, recoveryCodes []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err = m.replaceRecoveryCodesTx(ctx, tx, userID, recoveryCodes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m TOTPModel) replaceRecoveryCodesTx(ctx context.Context, tx *sql.Tx, userID string, recoveryCodes []string) error {
+	_, err := tx.ExecContext(ctx, ` DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	for _, code := range recoveryCodes {
+		_, err = tx.ExecContext(ctx, ` INSERT INTO totp_recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode() marks an unused recovery code as used, or returns
+// ErrRecordNotFound if the code is unknown or was used before.
+func (m TOTPModel) UseRecoveryCode(userID, code string) error {
+	query := ` UPDATE totp_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m TOTPModel) Delete(userID string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = tx.ExecContext(ctx, ` DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, ` DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/olagookundavid/itoju/internal/validator"
+)
+
+const (
+	ModeCycle            = "cycle"
+	ModeTryingToConceive = "trying_to_conceive"
+	ModePregnancy        = "pregnancy"
+	ModePerimenopause    = "perimenopause"
+	ModeMenopause        = "menopause"
+)
+
+var TrackingModes = []string{ModeCycle, ModeTryingToConceive, ModePregnancy, ModePerimenopause, ModeMenopause}
+
+const (
+	// pregnancyLength is the length of a pregnancy counted from the last period.
+	pregnancyLength = 280
+	// maxPregnancyDays bounds how far back the start of a pregnancy may be.
+	maxPregnancyDays = 308
+)
+
+type TrackingMode struct {
+	UserID         string     `json:"-"`
+	Mode           string     `json:"mode"`
+	PregnancyStart *time.Time `json:"pregnancy_start,omitempty"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type Pregnancy struct {
+	Start           time.Time `json:"start"`
+	DueDate         time.Time `json:"due_date"`
+	GestationalWeek int       `json:"gestational_week"`
+	GestationalDay  int       `json:"gestational_day"`
+	Trimester       int       `json:"trimester"`
+}
+
+func ValidateTrackingMode(v *validator.Validator, mode *TrackingMode, now time.Time) {
+	v.Check(validator.PermittedValue(mode.Mode, TrackingModes...), "mode", "must be one of cycle, trying_to_conceive, pregnancy, perimenopause or menopause")
+	if mode.Mode == ModePregnancy {
+		v.Check(mode.PregnancyStart != nil, "pregnancy_start", "must be provided in pregnancy mode")
+		if mode.PregnancyStart != nil {
+			days := int(TruncateToDay(now).Sub(TruncateToDay(*mode.PregnancyStart)).Hours() / 24)
+			v.Check(days >= 0, "pregnancy_start", "must not be in the future")
+			v.Check(days <= maxPregnancyDays, "pregnancy_start", "must not be more than 44 weeks ago")
+		}
+	}
+}
+
+// estimatesOvulation reports whether ovulation is estimated in a mode. Around and
+// after menopause, and during pregnancy, it is only marked once confirmed from
+// temperature readings.
+func estimatesOvulation(mode string) bool {
+	return mode == ModeCycle || mode == ModeTryingToConceive
+}
+
+// predictsPeriods reports whether upcoming periods are predicted in a mode.
+func predictsPeriods(mode string) bool {
+	return mode != ModePregnancy && mode != ModeMenopause
+}
+
+// Pregnancy dates the pregnancy of a user in pregnancy mode, with weeks and days
+// counted from the first day of the last period.
+func (t *TrackingMode) Pregnancy(now time.Time) *Pregnancy {
+	if t.Mode != ModePregnancy || t.PregnancyStart == nil {
+		return nil
+	}
+	start := TruncateToDay(*t.PregnancyStart)
+	days := int(TruncateToDay(now).Sub(start).Hours() / 24)
+	pregnancy := &Pregnancy{
+		Start:           start,
+		DueDate:         start.AddDate(0, 0, pregnancyLength),
+		GestationalWeek: days / 7,
+		GestationalDay:  days % 7,
+		Trimester:       3,
+	}
+	switch {
+	case pregnancy.GestationalWeek < 14:
+		pregnancy.Trimester = 1
+	case pregnancy.GestationalWeek < 28:
+		pregnancy.Trimester = 2
+	}
+	return pregnancy
+}
+
+// GetTrackingMode() returns the tracking mode of a user, cycle tracking unless the
+// user chose another.
+func (m *UserPeriodModel) GetTrackingMode(userID string) (*TrackingMode, error) {
+	query := `SELECT mode, pregnancy_start, updated_at FROM user_tracking_modes WHERE user_id = $1`
+	mode := TrackingMode{UserID: userID, Mode: ModeCycle}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&mode.Mode, &mode.PregnancyStart, &mode.UpdatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &mode, nil
+}
+
+// SetTrackingMode() saves the tracking mode of a user. When the mode changes, the
+// phase flags of every logged cycle are worked out again for the new mode.
+func (m *UserPeriodModel) SetTrackingMode(mode *TrackingMode) error {
+	if mode.Mode != ModePregnancy {
+		mode.PregnancyStart = nil
+	}
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	previous := ModeCycle
+	err = tx.QueryRowContext(ctx, `SELECT mode FROM user_tracking_modes WHERE user_id = $1`, mode.UserID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	query := `INSERT INTO user_tracking_modes (user_id, mode, pregnancy_start)
+              VALUES ($1, $2, $3)
+              ON CONFLICT (user_id) DO UPDATE SET mode = EXCLUDED.mode,
+              pregnancy_start = EXCLUDED.pregnancy_start, updated_at = NOW()
+              RETURNING updated_at`
+	err = tx.QueryRowContext(ctx, query, mode.UserID, mode.Mode, mode.PregnancyStart).Scan(&mode.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if mode.Mode != previous {
+		cycles, err := getMenstrualCycles(tx, mode.UserID)
+		if err != nil {
+			return err
+		}
+		for i := range cycles {
+			err = m.confirmOvulationTx(tx, &cycles[i], mode.Mode)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
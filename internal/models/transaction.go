@@ -1,6 +1,17 @@
 package models
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx, so an insert the import shares
+// with the handlers is written once and runs inside or outside a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
 
 type TransactionModel struct {
 	DB *sql.DB
@@ -9,3 +20,20 @@ type TransactionModel struct {
 func (m *TransactionModel) BeginTx() (*sql.Tx, error) {
 	return m.DB.Begin()
 }
+
+// Savepoint() marks a point in tx that RollbackToSavepoint() can return to, so a
+// single failing statement doesn't abort the whole transaction.
+func (m *TransactionModel) Savepoint(tx *sql.Tx, name string) error {
+	_, err := tx.Exec("SAVEPOINT " + name)
+	return err
+}
+
+func (m *TransactionModel) RollbackToSavepoint(tx *sql.Tx, name string) error {
+	_, err := tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+	return err
+}
+
+func (m *TransactionModel) ReleaseSavepoint(tx *sql.Tx, name string) error {
+	_, err := tx.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
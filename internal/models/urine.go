@@ -75,7 +75,14 @@ func (m UrineMetricModel) GetUserUrineMetric(userId string, id int64) (*UrineMet
 }
 
 func (m UrineMetricModel) InsertUrineMetric(userID string, urineMetric *UrineMetric) error {
+	return insertUrineMetric(m.DB, userID, urineMetric)
+}
+
+func (m UrineMetricModel) InsertUrineMetricTx(tx *sql.Tx, userID string, urineMetric *UrineMetric) error {
+	return insertUrineMetric(tx, userID, urineMetric)
+}
 
+func insertUrineMetric(db execer, userID string, urineMetric *UrineMetric) error {
 	query := `
 	INSERT INTO user_urine_metric (user_id, time, pain, type, date, tags, quantity)
 	VALUES ($1, $2, $3, $4, $5, $6, $7) `
@@ -83,11 +90,8 @@ func (m UrineMetricModel) InsertUrineMetric(userID string, urineMetric *UrineMet
 	args := []any{userID, urineMetric.Time, urineMetric.Pain, urineMetric.Type, urineMetric.Date, pq.Array(urineMetric.Tags), urineMetric.Quantity}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
 }
 
 func (m UrineMetricModel) UpdateUrineMetric(urineMetric *UrineMetric) error {
@@ -0,0 +1,17 @@
+package notifier
+
+import "github.com/olagookundavid/itoju/internal/mailer"
+
+// EmailNotifier delivers notifications by email, rendering the mail template named
+// after the notification kind.
+type EmailNotifier struct {
+	mailer mailer.Mailer
+}
+
+func NewEmail(m mailer.Mailer) *EmailNotifier {
+	return &EmailNotifier{mailer: m}
+}
+
+func (n *EmailNotifier) Notify(notification Notification) error {
+	return n.mailer.Send(notification.Email, notification.Kind+".tmpl", notification.Data)
+}
@@ -0,0 +1,29 @@
+package notifier
+
+import "sync"
+
+// MemoryNotifier keeps notifications in memory instead of delivering them.
+type MemoryNotifier struct {
+	mu            sync.Mutex
+	notifications []Notification
+}
+
+func NewMemory() *MemoryNotifier {
+	return &MemoryNotifier{}
+}
+
+func (n *MemoryNotifier) Notify(notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+// Notifications returns a copy of every notification sent so far.
+func (n *MemoryNotifier) Notifications() []Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	notifications := make([]Notification, len(n.notifications))
+	copy(notifications, n.notifications)
+	return notifications
+}
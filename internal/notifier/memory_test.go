@@ -0,0 +1,21 @@
+package notifier
+
+import "testing"
+
+func TestMemoryNotifier(t *testing.T) {
+	n := NewMemory()
+	err := n.Notify(Notification{UserID: "1", Kind: KindPeriodUpcoming})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifications := n.Notifications()
+	if len(notifications) != 1 || notifications[0].Kind != KindPeriodUpcoming {
+		t.Fatalf("got %v; want one %s notification", notifications, KindPeriodUpcoming)
+	}
+
+	// The returned slice is a copy.
+	notifications[0].Kind = KindPeriodLate
+	if got := n.Notifications()[0].Kind; got != KindPeriodUpcoming {
+		t.Errorf("got kind %q after changing the copy; want %q", got, KindPeriodUpcoming)
+	}
+}
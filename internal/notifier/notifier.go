@@ -0,0 +1,24 @@
+package notifier
+
+// Kinds of notification the application sends.
+const (
+	KindPeriodUpcoming     = "period_upcoming"
+	KindPeriodLate         = "period_late"
+	KindMedicationReminder = "medication_reminder"
+)
+
+// Notifier is implemented by every channel a notification can be delivered
+// through. Email is used in production, the memory notifier stands in for it in
+// tests.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Notification is a message for one user. Data is passed to whatever renders the
+// notification for the channel.
+type Notification struct {
+	UserID string
+	Email  string
+	Kind   string
+	Data   map[string]any
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/olagookundavid/itoju/cmd/api"
+	"github.com/olagookundavid/itoju/internal/models"
 )
 
 func Routes(app *api.Application) http.Handler {
@@ -18,14 +19,45 @@ func Routes(app *api.Application) http.Handler {
 
 	//Users auth
 	router.HandlerFunc(http.MethodPost, "/v1/login", app.LoginHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/login/mfa", app.MFALoginHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.RefreshTokenHandler)
+	router.Handler(http.MethodPost, "/v1/logout", app.RequireActivatedAndAuthedUser(app.LogoutHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/register", app.RegisterUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.ActivateUserHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.CreateActivationTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/password-reset", app.CreatePasswordResetTokenHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.UpdateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/unlocked", app.UnlockUserHandler)
 	router.Handler(http.MethodPut, "/v1/users/change-password", app.RequireActivatedAndAuthedUser(app.ChangeUserPasswordHandler))
+	router.Handler(http.MethodDelete, "/v1/users/me", app.RequireActivatedAndAuthedUser(app.DeleteUserHandler))
+
+	//Sessions
+	router.Handler(http.MethodGet, "/v1/users/sessions", app.RequireActivatedAndAuthedUser(app.GetSessionsHandler))
+	router.Handler(http.MethodDelete, "/v1/users/sessions", app.RequireActivatedAndAuthedUser(app.DeleteAllSessionsHandler))
+	router.Handler(http.MethodDelete, "/v1/users/sessions/:id", app.RequireActivatedAndAuthedUser(app.DeleteSessionHandler))
+
+	//Two-factor authentication
+	router.Handler(http.MethodPost, "/v1/users/mfa/totp", app.RequireActivatedAndAuthedUser(app.EnrollTOTPHandler))
+	router.Handler(http.MethodPut, "/v1/users/mfa/totp", app.RequireActivatedAndAuthedUser(app.ConfirmTOTPHandler))
+	router.Handler(http.MethodDelete, "/v1/users/mfa/totp", app.RequireActivatedAndAuthedUser(app.DisableTOTPHandler))
+	router.Handler(http.MethodPost, "/v1/users/mfa/recovery_codes", app.RequireActivatedAndAuthedUser(app.RegenerateRecoveryCodesHandler))
+
+	//Data export and import
+	router.Handler(http.MethodPost, "/v1/user/exports", app.RequireActivatedAndAuthedUser(app.CreateDataExportHandler))
+	router.Handler(http.MethodGet, "/v1/user/exports/:id", app.RequireActivatedAndAuthedUser(app.GetDataExportHandler))
+	router.Handler(http.MethodPost, "/v1/user/imports", app.RequireActivatedAndAuthedUser(app.ImportDataHandler))
 
 	//Profile
 	router.Handler(http.MethodGet, "/v1/users/profile", app.RequireActivatedAndAuthedUser(app.GetUserProfileHandler))
 	router.Handler(http.MethodPut, "/v1/users/profile_pic", app.RequireActivatedAndAuthedUser(app.UpdateUserProfilePicHandler))
+	router.Handler(http.MethodGet, "/v1/users/notifications/preferences", app.RequireActivatedAndAuthedUser(app.GetNotificationPreferencesHandler))
+	router.Handler(http.MethodPut, "/v1/users/notifications/preferences", app.RequireActivatedAndAuthedUser(app.UpdateNotificationPreferencesHandler))
+	router.Handler(http.MethodPatch, "/v1/users/profile", app.RequireActivatedAndAuthedUser(app.UpdateUserProfileHandler))
+	router.Handler(http.MethodPost, "/v1/users/email", app.RequireActivatedAndAuthedUser(app.CreateEmailChangeHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.ConfirmEmailChangeHandler)
+	router.Handler(http.MethodPost, "/v1/users/calendar_feed", app.RequireActivatedAndAuthedUser(app.CreateCalendarFeedHandler))
+	router.Handler(http.MethodDelete, "/v1/users/calendar_feed", app.RequireActivatedAndAuthedUser(app.DeleteCalendarFeedHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/calendar/:token", app.GetCalendarFeedHandler)
 
 	//User tracked metrics
 	router.Handler(http.MethodPost, "/v1/user/metrics", app.RequireActivatedAndAuthedUser(app.SetUserMetrics))
@@ -55,9 +87,9 @@ func Routes(app *api.Application) http.Handler {
 
 	//Resources
 	router.HandlerFunc(http.MethodGet, "/v1/resources", (app.GetResources))
-	router.HandlerFunc(http.MethodPost, "/v1/resources", (app.InsertResources))
-	router.HandlerFunc(http.MethodPut, "/v1/resources/:id", (app.UpdateResources))
-	router.HandlerFunc(http.MethodDelete, "/v1/resources/:id", (app.DeleteResources))
+	router.Handler(http.MethodPost, "/v1/resources", app.RequirePermission(models.PermissionResourcesWrite, app.InsertResources))
+	router.Handler(http.MethodPut, "/v1/resources/:id", app.RequirePermission(models.PermissionResourcesWrite, app.UpdateResources))
+	router.Handler(http.MethodDelete, "/v1/resources/:id", app.RequirePermission(models.PermissionResourcesWrite, app.DeleteResources))
 
 	//Setting
 	router.Handler(http.MethodGet, "/v1/user/menses", app.RequireActivatedAndAuthedUser((app.GetMenses)))
@@ -87,6 +119,7 @@ func Routes(app *api.Application) http.Handler {
 	router.Handler(http.MethodPost, "/v1/user/exercise_metrics/:date", app.RequireActivatedAndAuthedUser((app.CreateExerciseMetric)))
 	router.Handler(http.MethodPut, "/v1/user/exercise_metrics/:id", app.RequireActivatedAndAuthedUser((app.UpdateExerciseMetric)))
 	router.Handler(http.MethodDelete, "/v1/user/exercise_metrics/:id", app.RequireActivatedAndAuthedUser((app.DeleteExerciseMetric)))
+	router.Handler(http.MethodGet, "/v1/user/exercise_weekly_analytics/:weeks", app.RequireActivatedAndAuthedUser((app.GetExerciseWeeklyAnalytics)))
 
 	//UrineMetrics
 	router.Handler(http.MethodGet, "/v1/user/urine_metrics/:date", app.RequireActivatedAndAuthedUser((app.GetUserUrineMetrics)))
@@ -94,12 +127,35 @@ func Routes(app *api.Application) http.Handler {
 	router.Handler(http.MethodPost, "/v1/user/urine_metrics/:date", app.RequireActivatedAndAuthedUser((app.CreateUrineMetric)))
 	router.Handler(http.MethodDelete, "/v1/user/urine_metrics/:id", app.RequireActivatedAndAuthedUser((app.DeleteUrineMetric)))
 
+	//HydrationMetrics
+	router.Handler(http.MethodGet, "/v1/user/hydration_metrics/:date", app.RequireActivatedAndAuthedUser((app.GetUserHydrationMetrics)))
+	router.Handler(http.MethodPost, "/v1/user/hydration_metrics/:date", app.RequireActivatedAndAuthedUser((app.CreateHydrationMetric)))
+	router.Handler(http.MethodPut, "/v1/user/hydration_metrics/:id", app.RequireActivatedAndAuthedUser((app.UpdateHydrationMetric)))
+	router.Handler(http.MethodDelete, "/v1/user/hydration_metrics/:id", app.RequireActivatedAndAuthedUser((app.DeleteHydrationMetric)))
+
 	//MedicationMetrics
 	router.Handler(http.MethodGet, "/v1/user/medication_metrics/:date", app.RequireActivatedAndAuthedUser((app.GetUserMedicationMetrics)))
 	router.Handler(http.MethodPut, "/v1/user/medication_metrics/:id", app.RequireActivatedAndAuthedUser((app.UpdateMedicationMetric)))
 	router.Handler(http.MethodPost, "/v1/user/medication_metrics/:date", app.RequireActivatedAndAuthedUser((app.CreateMedicationMetric)))
 	router.Handler(http.MethodDelete, "/v1/user/medication_metrics/:id", app.RequireActivatedAndAuthedUser((app.DeleteMedicationMetric)))
 
+	//Medications
+	router.Handler(http.MethodGet, "/v1/user/medications", app.RequireActivatedAndAuthedUser((app.SearchMedications)))
+	router.Handler(http.MethodPost, "/v1/user/medications", app.RequireActivatedAndAuthedUser((app.CreateCustomMedication)))
+	router.Handler(http.MethodDelete, "/v1/user/medications/:id", app.RequireActivatedAndAuthedUser((app.DeleteCustomMedication)))
+
+	//MedicationPlans
+	router.Handler(http.MethodGet, "/v1/user/medication_plans", app.RequireActivatedAndAuthedUser((app.GetMedicationPlans)))
+	router.Handler(http.MethodPost, "/v1/user/medication_plans", app.RequireActivatedAndAuthedUser((app.CreateMedicationPlan)))
+	router.Handler(http.MethodGet, "/v1/user/medication_plans/:id", app.RequireActivatedAndAuthedUser((app.GetMedicationPlan)))
+	router.Handler(http.MethodPut, "/v1/user/medication_plans/:id", app.RequireActivatedAndAuthedUser((app.UpdateMedicationPlan)))
+	router.Handler(http.MethodDelete, "/v1/user/medication_plans/:id", app.RequireActivatedAndAuthedUser((app.DeleteMedicationPlan)))
+	router.Handler(http.MethodGet, "/v1/user/medication_plans/:id/doses", app.RequireActivatedAndAuthedUser((app.GetMedicationPlanDoses)))
+	router.Handler(http.MethodPut, "/v1/user/medication_plans/:id/doses", app.RequireActivatedAndAuthedUser((app.RecordMedicationDose)))
+	router.Handler(http.MethodDelete, "/v1/user/medication_plans/:id/doses", app.RequireActivatedAndAuthedUser((app.DeleteMedicationDose)))
+	router.Handler(http.MethodGet, "/v1/user/medication_doses", app.RequireActivatedAndAuthedUser((app.GetMedicationDoses)))
+	router.Handler(http.MethodGet, "/v1/user/medication_adherence", app.RequireActivatedAndAuthedUser((app.GetMedicationAdherence)))
+
 	//BowelMetrics
 	router.Handler(http.MethodGet, "/v1/user/bowel_metrics/:date", app.RequireActivatedAndAuthedUser((app.GetUserBowelMetrics)))
 	router.Handler(http.MethodPut, "/v1/user/bowel_metrics/:id", app.RequireActivatedAndAuthedUser((app.UpdateBowelMetric)))
@@ -113,16 +169,23 @@ func Routes(app *api.Application) http.Handler {
 	//7Days Analytics
 	router.Handler(http.MethodGet, "/v1/user/tag_days_analytics/:days/:tag", app.RequireActivatedAndAuthedUser((app.GetTagsDaysAnalytics)))
 	router.Handler(http.MethodGet, "/v1/user/bowel_days_analytics/:days", app.RequireActivatedAndAuthedUser((app.GetBowelDaysAnalytics)))
+	router.Handler(http.MethodGet, "/v1/user/sleep_days_analytics/:days", app.RequireActivatedAndAuthedUser((app.GetSleepDaysAnalytics)))
+	router.Handler(http.MethodGet, "/v1/user/hydration_days_analytics/:days", app.RequireActivatedAndAuthedUser((app.GetHydrationDaysAnalytics)))
 	router.Handler(http.MethodGet, "/v1/user/syms_days_analytics/:id/:days", app.RequireActivatedAndAuthedUser((app.GetSymsDaysAnalytics)))
+	router.Handler(http.MethodGet, "/v1/user/syms_phase_analytics/:days", app.RequireActivatedAndAuthedUser((app.GetSymsPhaseAnalytics)))
 
 	//Month Analytics
 	router.Handler(http.MethodGet, "/v1/user/tag_month_analytics/:month/:tag", app.RequireActivatedAndAuthedUser((app.GetTagsMonthAnalytics)))
 	router.Handler(http.MethodGet, "/v1/user/bowel_month_analytics/:month", app.RequireActivatedAndAuthedUser((app.GetMonthBowelAnalytics)))
+	router.Handler(http.MethodGet, "/v1/user/sleep_month_analytics/:month", app.RequireActivatedAndAuthedUser((app.GetMonthSleepAnalytics)))
+	router.Handler(http.MethodGet, "/v1/user/hydration_month_analytics/:month", app.RequireActivatedAndAuthedUser((app.GetMonthHydrationAnalytics)))
 	router.Handler(http.MethodGet, "/v1/user/syms_month_analytics/:id/:month", app.RequireActivatedAndAuthedUser((app.GetSymsMonthAnalytics)))
 
 	//Year Analytics
 	router.Handler(http.MethodGet, "/v1/user/tag_year_analytics/:year/:tag", app.RequireActivatedAndAuthedUser((app.GetTagsYearAnalytics)))
 	router.Handler(http.MethodGet, "/v1/user/bowel_year_analytics/:year", app.RequireActivatedAndAuthedUser((app.GetBowelYearAnalytics)))
+	router.Handler(http.MethodGet, "/v1/user/sleep_year_analytics/:year", app.RequireActivatedAndAuthedUser((app.GetSleepYearAnalytics)))
+	router.Handler(http.MethodGet, "/v1/user/hydration_year_analytics/:year", app.RequireActivatedAndAuthedUser((app.GetHydrationYearAnalytics)))
 	router.Handler(http.MethodGet, "/v1/user/syms_year_analytics/:id/:year", app.RequireActivatedAndAuthedUser((app.GetSymsYearAnalytics)))
 
 	//User Points
@@ -132,11 +195,23 @@ func Routes(app *api.Application) http.Handler {
 	//Period
 	router.Handler(http.MethodPost, "/v1/user/period", app.RequireActivatedAndAuthedUser((app.AddMenstrualCycle)))
 	router.Handler(http.MethodGet, "/v1/user/period", app.RequireActivatedAndAuthedUser((app.GetMenstrualCycle)))
+	router.Handler(http.MethodGet, "/v1/user/period/predictions", app.RequireActivatedAndAuthedUser((app.GetPeriodPredictions)))
+	router.Handler(http.MethodGet, "/v1/user/period/stats", app.RequireActivatedAndAuthedUser((app.GetPeriodStats)))
+	router.Handler(http.MethodGet, "/v1/user/period/mode", app.RequireActivatedAndAuthedUser((app.GetTrackingMode)))
 	router.Handler(http.MethodGet, "/v1/user/cycle_day/:id", app.RequireActivatedAndAuthedUser((app.GetCycleDay)))
-	router.Handler(http.MethodPut, "/v1/user/period/:id", app.RequireActivatedAndAuthedUser((app.UpdateMenstrualCycle)))
+	router.Handler(http.MethodPut, "/v1/user/cycle_day/:id", app.RequireActivatedAndAuthedUser((app.UpdateMenstrualCycle)))
+	// PUT /v1/user/period/mode, /v1/user/period/cycles/:id and the original
+	// /v1/user/period/:id cycle-day update.
+	router.Handler(http.MethodPut, "/v1/user/period/*path", app.RequireActivatedAndAuthedUser((app.UpdatePeriodRoute)))
+	router.Handler(http.MethodDelete, "/v1/user/period/cycles/:id", app.RequireActivatedAndAuthedUser((app.DeleteMenstrualCycle)))
+
+	//Admin
+	router.Handler(http.MethodGet, "/v1/admin/roles", app.RequirePermission(models.PermissionUsersManage, app.GetRolesHandler))
+	router.Handler(http.MethodGet, "/v1/admin/users/:id/roles", app.RequirePermission(models.PermissionUsersManage, app.GetUserRolesHandler))
+	router.Handler(http.MethodPut, "/v1/admin/users/:id/roles", app.RequirePermission(models.PermissionUsersManage, app.SetUserRolesHandler))
 
 	//Metrics
-	router.Handler(http.MethodGet, "/v1/debug/vars", expvar.Handler())
+	router.Handler(http.MethodGet, "/v1/debug/vars", app.RequirePermission(models.PermissionMetricsView, expvar.Handler().ServeHTTP))
 
 	//Middleware
 	return app.Metrics(app.RecoverPanic(app.RateLimit(app.Authenticate(router))))
@@ -0,0 +1,235 @@
+// Package rrule parses and expands the subset of RFC 5545 recurrence rules used for
+// medication schedules: FREQ (DAILY, WEEKLY or MONTHLY), INTERVAL, BYDAY,
+// BYMONTHDAY, COUNT and UNTIL. Occurrences are whole days; times of day are kept
+// by the caller.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+const dateLayout = "20060102"
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Rule is a parsed recurrence rule. A zero Count or Until means the rule doesn't
+// end on its own.
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+}
+
+// Parse parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH". The "RRULE:"
+// prefix is optional.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("rrule: empty rule")
+	}
+	r := &Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("rrule: malformed part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("rrule: %s given more than once", name)
+		}
+		seen[name] = true
+		switch name {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly {
+				return nil, fmt.Errorf("rrule: unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("rrule: INTERVAL must be a positive integer")
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("rrule: COUNT must be a positive integer")
+			}
+			r.Count = n
+		case "UNTIL":
+			// Only the date of a date-time UNTIL is used.
+			if len(value) < len(dateLayout) {
+				return nil, fmt.Errorf("rrule: malformed UNTIL %q", value)
+			}
+			until, err := time.Parse(dateLayout, value[:len(dateLayout)])
+			if err != nil {
+				return nil, fmt.Errorf("rrule: malformed UNTIL %q", value)
+			}
+			r.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return nil, fmt.Errorf("rrule: unsupported BYDAY %q", day)
+				}
+				if !slices.Contains(r.ByDay, weekday) {
+					r.ByDay = append(r.ByDay, weekday)
+				}
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n < 1 || n > 31 {
+					return nil, fmt.Errorf("rrule: BYMONTHDAY must be between 1 and 31")
+				}
+				if !slices.Contains(r.ByMonthDay, n) {
+					r.ByMonthDay = append(r.ByMonthDay, n)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("rrule: unsupported part %s", name)
+		}
+	}
+	if r.Freq == "" {
+		return nil, errors.New("rrule: FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("rrule: COUNT and UNTIL can't both be given")
+	}
+	if r.Freq == Monthly && len(r.ByDay) > 0 {
+		return nil, errors.New("rrule: BYDAY is not supported with FREQ=MONTHLY")
+	}
+	slices.Sort(r.ByDay)
+	slices.Sort(r.ByMonthDay)
+	return r, nil
+}
+
+// String formats the rule in its canonical form.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, weekday := range r.ByDay {
+			days[i] = strings.ToUpper(weekday.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format(dateLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the days the rule occurs on from start, the first day of the
+// series, that fall between from and to inclusive.
+func (r *Rule) Between(start, from, to time.Time) []time.Time {
+	start, from, to = day(start), day(from), day(to)
+	if !r.Until.IsZero() && r.Until.Before(to) {
+		to = day(r.Until)
+	}
+	// Without a count an occurrence only depends on start, so days before from need
+	// not be stepped through.
+	first := start
+	if r.Count == 0 && from.After(start) {
+		first = from
+	}
+	var dates []time.Time
+	count := 0
+	for d := first; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if !r.matches(start, d) {
+			continue
+		}
+		count++
+		if r.Count > 0 && count > r.Count {
+			break
+		}
+		if !d.Before(from) {
+			dates = append(dates, d)
+		}
+	}
+	return dates
+}
+
+// Includes reports whether the rule occurs on date.
+func (r *Rule) Includes(start, date time.Time) bool {
+	return len(r.Between(start, date, date)) == 1
+}
+
+func (r *Rule) matches(start, d time.Time) bool {
+	switch r.Freq {
+	case Daily:
+		days := int(d.Sub(start).Hours() / 24)
+		if days%r.Interval != 0 {
+			return false
+		}
+		if len(r.ByDay) > 0 && !slices.Contains(r.ByDay, d.Weekday()) {
+			return false
+		}
+		return len(r.ByMonthDay) == 0 || slices.Contains(r.ByMonthDay, d.Day())
+	case Weekly:
+		// Weeks start on Monday, the RFC 5545 default.
+		weeks := int(weekStart(d).Sub(weekStart(start)).Hours() / 24 / 7)
+		if weeks%r.Interval != 0 {
+			return false
+		}
+		if len(r.ByDay) == 0 {
+			return d.Weekday() == start.Weekday()
+		}
+		return slices.Contains(r.ByDay, d.Weekday())
+	case Monthly:
+		months := (d.Year()-start.Year())*12 + int(d.Month()) - int(start.Month())
+		if months%r.Interval != 0 {
+			return false
+		}
+		if len(r.ByMonthDay) == 0 {
+			return d.Day() == start.Day()
+		}
+		return slices.Contains(r.ByMonthDay, d.Day())
+	}
+	return false
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func weekStart(d time.Time) time.Time {
+	offset := (int(d.Weekday()) + 6) % 7
+	return d.AddDate(0, 0, -offset)
+}
@@ -28,23 +28,25 @@ func Serve(app *api.Application) error {
 	}
 	shutdownError := make(chan error)
 
-	app.Background(
-		func() {
-			// Intercept the signals, as before.
-			quit := make(chan os.Signal, 1)
-			signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-			s := <-quit
-			app.Logger.PrintInfo("shutting down server", map[string]string{"signal": s.String()})
-			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-			defer cancel()
-			err := srv.Shutdown(ctx)
-			if err != nil {
-				shutdownError <- err
-			}
-			app.Logger.PrintInfo("completing background tasks", map[string]string{"addr": srv.Addr})
+	go func() {
+		// Intercept the signals, as before.
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+		app.Logger.PrintInfo("shutting down server", map[string]string{"signal": s.String()})
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+		app.Logger.PrintInfo("completing background tasks", map[string]string{"addr": srv.Addr})
 
-			shutdownError <- nil
-		})
+		// Wait for background goroutines, such as pending emails, to finish.
+		app.Wg.Wait()
+		shutdownError <- nil
+	}()
 
 	logger.PrintInfo("starting server", map[string]string{"addr": srv.Addr, "env": app.Config.Env})
 	err := srv.ListenAndServe()
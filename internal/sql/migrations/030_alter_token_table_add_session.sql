@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE tokens
+    ADD COLUMN session_id text,
+    ADD COLUMN device text NOT NULL DEFAULT '',
+    ADD COLUMN ip text NOT NULL DEFAULT '',
+    ADD COLUMN created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS tokens_session_id_idx ON tokens (session_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS tokens_session_id_idx;
+
+ALTER TABLE tokens
+    DROP COLUMN session_id,
+    DROP COLUMN device,
+    DROP COLUMN ip,
+    DROP COLUMN created_at;
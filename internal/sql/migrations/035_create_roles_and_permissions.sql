@@ -0,0 +1,54 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    name text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    granted_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('resources:write'),
+    ('metrics:view'),
+    ('users:manage');
+
+INSERT INTO roles (name)
+VALUES
+    ('admin'),
+    ('editor');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin'
+   OR (roles.name = 'editor' AND permissions.code = 'resources:write');
+
+-- Changes made by one user to another, such as granting roles, record who made them.
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS actor_id UUID;
+
+-- Existing admins keep their access through the admin role.
+INSERT INTO users_roles (user_id, role_id)
+SELECT users.id, roles.id FROM users, roles
+WHERE users.isAdmin AND roles.name = 'admin';
+
+-- +goose Down
+ALTER TABLE audit_log DROP COLUMN IF EXISTS actor_id;
+DROP TABLE IF EXISTS users_roles;
+DROP TABLE IF EXISTS roles_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS permissions;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS user_email_changes (
+    user_id UUID PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    new_email citext NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_email_changes;
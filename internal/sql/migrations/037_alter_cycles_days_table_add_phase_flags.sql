@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE cycles_days ADD COLUMN is_fertile BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE cycles_days ADD COLUMN is_luteal BOOLEAN NOT NULL DEFAULT false;
+
+-- Ovulation is a luteal phase (14 days) before the next period, but never during
+-- the period itself. The fertile window is the five days before ovulation, the
+-- ovulation day and the day after.
+UPDATE cycles_days cd SET
+    is_ovulation = d.day = d.ovulation,
+    is_fertile = d.day BETWEEN d.ovulation - 5 AND d.ovulation + 1 AND d.day >= d.period_length,
+    is_luteal = d.day > d.ovulation
+FROM (
+    SELECT cd.id, cd.date - mc.start_date AS day, mc.period_length,
+        GREATEST(mc.cycle_length - 14, mc.period_length) AS ovulation
+    FROM cycles_days cd
+    INNER JOIN menstrual_cycles mc ON mc.id = cd.cycle_id
+) d
+WHERE cd.id = d.id;
+
+-- +goose Down
+UPDATE cycles_days cd SET is_ovulation = cd.date - mc.start_date >= mc.period_length + 9
+FROM menstrual_cycles mc
+WHERE mc.id = cd.cycle_id;
+
+ALTER TABLE cycles_days DROP COLUMN IF EXISTS is_luteal;
+ALTER TABLE cycles_days DROP COLUMN IF EXISTS is_fertile;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE menstrual_cycles DROP CONSTRAINT IF EXISTS menstrual_cycles_start_date_key;
+ALTER TABLE menstrual_cycles ADD CONSTRAINT menstrual_cycles_user_id_start_date_key UNIQUE (user_id, start_date);
+
+-- +goose Down
+ALTER TABLE menstrual_cycles DROP CONSTRAINT IF EXISTS menstrual_cycles_user_id_start_date_key;
+ALTER TABLE menstrual_cycles ADD CONSTRAINT menstrual_cycles_start_date_key UNIQUE (start_date);
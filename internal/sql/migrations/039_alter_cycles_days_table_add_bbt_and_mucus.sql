@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE cycles_days ADD COLUMN temperature NUMERIC(4,2) CHECK (temperature BETWEEN 34 AND 42);
+ALTER TABLE cycles_days ADD COLUMN cervical_mucus TEXT NOT NULL DEFAULT ''
+    CHECK (cervical_mucus IN ('', 'dry', 'sticky', 'creamy', 'watery', 'egg_white'));
+ALTER TABLE menstrual_cycles ADD COLUMN confirmed_ovulation_date DATE;
+
+-- +goose Down
+ALTER TABLE menstrual_cycles DROP COLUMN IF EXISTS confirmed_ovulation_date;
+ALTER TABLE cycles_days DROP COLUMN IF EXISTS cervical_mucus;
+ALTER TABLE cycles_days DROP COLUMN IF EXISTS temperature;
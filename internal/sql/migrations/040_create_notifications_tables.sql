@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE notification_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    period_upcoming BOOLEAN NOT NULL DEFAULT true,
+    period_late BOOLEAN NOT NULL DEFAULT true,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- One row per notification sent, so the daily job never sends the same one twice.
+CREATE TABLE notifications_sent (
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    reference_date DATE NOT NULL,
+    sent_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, kind, reference_date)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS notifications_sent;
+DROP TABLE IF EXISTS notification_preferences;
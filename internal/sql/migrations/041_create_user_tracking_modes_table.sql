@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE user_tracking_modes (
+    user_id UUID PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    mode TEXT NOT NULL DEFAULT 'cycle'
+        CHECK (mode IN ('cycle', 'trying_to_conceive', 'pregnancy', 'perimenopause', 'menopause')),
+    -- First day of the last menstrual period, from which a pregnancy is dated.
+    pregnancy_start DATE,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (mode <> 'pregnancy' OR pregnancy_start IS NOT NULL)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_tracking_modes;
@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE medication_plans (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    dose NUMERIC(8,2) NOT NULL CHECK (dose > 0),
+    unit TEXT NOT NULL,
+    -- A recurrence rule such as FREQ=WEEKLY;BYDAY=MO,TH, see internal/rrule.
+    frequency TEXT NOT NULL,
+    -- Times of day, as HH:MM, a dose is due on every day the rule occurs.
+    times TEXT[] NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE,
+    reminders BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version INTEGER NOT NULL DEFAULT 1,
+    CHECK (end_date IS NULL OR end_date >= start_date)
+);
+
+CREATE INDEX medication_plans_user_id_idx ON medication_plans (user_id);
+
+-- Only doses the user answered are stored; expected doses are generated from the
+-- plan. A taken dose may point at the medication metric it was logged as.
+CREATE TABLE medication_doses (
+    plan_id BIGINT NOT NULL REFERENCES medication_plans ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    scheduled_at TIMESTAMP(0) NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('taken', 'skipped')),
+    metric_id INTEGER REFERENCES user_medication_metric ON DELETE SET NULL,
+    recorded_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (plan_id, scheduled_at)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS medication_doses;
+DROP TABLE IF EXISTS medication_plans;
@@ -0,0 +1,65 @@
+-- +goose Up
+-- The medication catalog. Rows with a user_id are custom medications saved by that
+-- user and only visible to them.
+CREATE TABLE IF NOT EXISTS medications (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    forms TEXT[] NOT NULL,
+    units TEXT[] NOT NULL,
+    user_id UUID REFERENCES users ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX medications_catalog_name_key ON medications (lower(name)) WHERE user_id IS NULL;
+CREATE UNIQUE INDEX medications_user_id_name_key ON medications (user_id, lower(name)) WHERE user_id IS NOT NULL;
+
+INSERT INTO medications (name, forms, units)
+VALUES
+    ('Ibuprofen', '{tablet,capsule,liquid,gel}', '{mg,ml,g}'),
+    ('Paracetamol', '{tablet,capsule,liquid,suppository}', '{mg,g,ml}'),
+    ('Naproxen', '{tablet}', '{mg}'),
+    ('Mefenamic acid', '{capsule,tablet}', '{mg}'),
+    ('Diclofenac', '{tablet,gel,suppository}', '{mg,g}'),
+    ('Tranexamic acid', '{tablet}', '{mg,g}'),
+    ('Combined oral contraceptive pill', '{tablet}', '{tablet}'),
+    ('Progestogen-only pill', '{tablet}', '{tablet}'),
+    ('Norethisterone', '{tablet}', '{mg}'),
+    ('Medroxyprogesterone', '{tablet,injection}', '{mg}'),
+    ('Dienogest', '{tablet}', '{mg}'),
+    ('Dydrogesterone', '{tablet}', '{mg}'),
+    ('Progesterone', '{capsule,pessary,gel,injection}', '{mg}'),
+    ('Estradiol', '{tablet,patch,gel,spray,ring}', '{mg,mcg,g,patch,puffs}'),
+    ('Letrozole', '{tablet}', '{mg}'),
+    ('Clomifene', '{tablet}', '{mg}'),
+    ('Metformin', '{tablet,liquid}', '{mg,ml}'),
+    ('Spironolactone', '{tablet}', '{mg}'),
+    ('Cabergoline', '{tablet}', '{mg,mcg}'),
+    ('Levothyroxine', '{tablet,liquid}', '{mcg,ml}'),
+    ('Folic acid', '{tablet}', '{mg,mcg}'),
+    ('Ferrous sulfate', '{tablet,liquid}', '{mg,ml}'),
+    ('Vitamin D', '{tablet,capsule,drops}', '{IU,mcg,drops}'),
+    ('Vitamin B12', '{tablet,injection}', '{mcg,mg}'),
+    ('Calcium carbonate', '{tablet}', '{mg,g}'),
+    ('Magnesium', '{tablet,capsule,powder}', '{mg,sachet}'),
+    ('Omeprazole', '{capsule,tablet}', '{mg}'),
+    ('Fluconazole', '{capsule}', '{mg}'),
+    ('Clotrimazole', '{cream,pessary}', '{mg,g}'),
+    ('Metronidazole', '{tablet,gel}', '{mg,g}'),
+    ('Nitrofurantoin', '{capsule,tablet}', '{mg}'),
+    ('Oxybutynin', '{tablet,patch}', '{mg,patch}'),
+    ('Amitriptyline', '{tablet}', '{mg}'),
+    ('Sertraline', '{tablet}', '{mg}'),
+    ('Codeine', '{tablet,liquid}', '{mg,ml}'),
+    ('Loperamide', '{capsule,tablet}', '{mg}'),
+    ('Lactulose', '{liquid}', '{ml}'),
+    ('Salbutamol', '{inhaler}', '{puffs,mcg}'),
+    ('Insulin', '{injection}', '{units}');
+
+-- Dosage and quantity hold fractions in the API but were rounded to whole numbers.
+ALTER TABLE user_medication_metric ALTER COLUMN dosage TYPE NUMERIC(8,2);
+ALTER TABLE user_medication_metric ALTER COLUMN quantity TYPE NUMERIC(8,2);
+
+-- +goose Down
+ALTER TABLE user_medication_metric ALTER COLUMN quantity TYPE SMALLINT;
+ALTER TABLE user_medication_metric ALTER COLUMN dosage TYPE SMALLINT;
+DROP TABLE IF EXISTS medications;
@@ -0,0 +1,59 @@
+-- +goose Up
+-- Sleep is stored as the wall-clock times it started and ended, without a time
+-- zone, instead of free-text times of day.
+ALTER TABLE user_sleep_metric ADD COLUMN slept_at TIMESTAMP(0);
+ALTER TABLE user_sleep_metric ADD COLUMN woke_at TIMESTAMP(0);
+
+-- The apps sent either full timestamps or times of day on the date of the entry.
+-- Anything else, including entries never completed and impossible dates such as
+-- 2024-02-31, can't be read and is left empty instead of failing the migration.
+-- Exercise times were sent the same way, so the function is kept for them.
+-- +goose StatementBegin
+CREATE FUNCTION migrate_clock_time(value TEXT, day DATE) RETURNS TIMESTAMP AS $$
+BEGIN
+    IF value ~ '^\s*\d{4}-\d{1,2}-\d{1,2}[T ]\d{1,2}:\d{2}' THEN
+        RETURN value::timestamp;
+    END IF;
+    IF value ~* '^\s*\d{1,2}:\d{2}(:\d{2})?\s*([ap]m)?\s*$' THEN
+        RETURN day + value::time;
+    END IF;
+    RETURN NULL;
+EXCEPTION WHEN invalid_datetime_format OR datetime_field_overflow THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+UPDATE user_sleep_metric SET
+    slept_at = migrate_clock_time(time_slept, date),
+    woke_at = migrate_clock_time(time_woke_up, date);
+
+-- Sleep that crossed midnight started the day before it ended.
+UPDATE user_sleep_metric SET slept_at = slept_at - INTERVAL '1 day'
+WHERE slept_at >= woke_at;
+
+-- An entry with only one readable time, or times that still don't make a sleep, has
+-- no usable length.
+UPDATE user_sleep_metric SET slept_at = NULL, woke_at = NULL
+WHERE slept_at IS NULL OR woke_at IS NULL OR slept_at >= woke_at;
+
+-- What the apps sent is kept, so entries that couldn't be read can still be
+-- recovered by hand. New entries leave these empty.
+ALTER TABLE user_sleep_metric RENAME COLUMN time_slept TO legacy_time_slept;
+ALTER TABLE user_sleep_metric RENAME COLUMN time_woke_up TO legacy_time_woke_up;
+ALTER TABLE user_sleep_metric ALTER COLUMN legacy_time_slept DROP NOT NULL;
+ALTER TABLE user_sleep_metric ALTER COLUMN legacy_time_woke_up DROP NOT NULL;
+ALTER TABLE user_sleep_metric ADD CONSTRAINT user_sleep_metric_woke_after_slept CHECK (woke_at > slept_at);
+
+-- +goose Down
+ALTER TABLE user_sleep_metric DROP CONSTRAINT IF EXISTS user_sleep_metric_woke_after_slept;
+ALTER TABLE user_sleep_metric RENAME COLUMN legacy_time_slept TO time_slept;
+ALTER TABLE user_sleep_metric RENAME COLUMN legacy_time_woke_up TO time_woke_up;
+UPDATE user_sleep_metric SET
+    time_slept = COALESCE(to_char(slept_at, 'HH24:MI'), time_slept, ''),
+    time_woke_up = COALESCE(to_char(woke_at, 'HH24:MI'), time_woke_up, '');
+ALTER TABLE user_sleep_metric ALTER COLUMN time_slept SET NOT NULL;
+ALTER TABLE user_sleep_metric ALTER COLUMN time_woke_up SET NOT NULL;
+ALTER TABLE user_sleep_metric DROP COLUMN IF EXISTS woke_at;
+ALTER TABLE user_sleep_metric DROP COLUMN IF EXISTS slept_at;
+DROP FUNCTION IF EXISTS migrate_clock_time(TEXT, DATE);
@@ -0,0 +1,37 @@
+-- +goose Up
+-- Exercise is stored as the wall-clock times it started and ended, without a time
+-- zone, instead of free-text times of day, and gets an intensity.
+ALTER TABLE user_exercise_metric ADD COLUMN started_at TIMESTAMP(0);
+ALTER TABLE user_exercise_metric ADD COLUMN ended_at TIMESTAMP(0);
+ALTER TABLE user_exercise_metric ADD COLUMN intensity TEXT NOT NULL DEFAULT 'moderate'
+    CHECK (intensity IN ('light', 'moderate', 'vigorous'));
+
+-- Times are read the way migration 044 reads sleep times.
+UPDATE user_exercise_metric SET
+    started_at = migrate_clock_time(started, date),
+    ended_at = migrate_clock_time(ended, date);
+
+-- Exercise that crossed midnight ended the day after it started.
+UPDATE user_exercise_metric SET ended_at = ended_at + INTERVAL '1 day'
+WHERE ended_at <= started_at;
+
+-- An end that still isn't after the start can't be right, so the entry is left
+-- without one, like an exercise never completed.
+UPDATE user_exercise_metric SET ended_at = NULL
+WHERE ended_at <= started_at OR started_at IS NULL;
+
+-- What the apps sent is kept, as it is for sleep.
+ALTER TABLE user_exercise_metric RENAME COLUMN started TO legacy_started;
+ALTER TABLE user_exercise_metric RENAME COLUMN ended TO legacy_ended;
+ALTER TABLE user_exercise_metric ADD CONSTRAINT user_exercise_metric_ended_after_started CHECK (ended_at > started_at);
+
+-- +goose Down
+ALTER TABLE user_exercise_metric DROP CONSTRAINT IF EXISTS user_exercise_metric_ended_after_started;
+ALTER TABLE user_exercise_metric RENAME COLUMN legacy_started TO started;
+ALTER TABLE user_exercise_metric RENAME COLUMN legacy_ended TO ended;
+UPDATE user_exercise_metric SET
+    started = COALESCE(to_char(started_at, 'HH24:MI'), started),
+    ended = COALESCE(to_char(ended_at, 'HH24:MI'), ended);
+ALTER TABLE user_exercise_metric DROP COLUMN IF EXISTS intensity;
+ALTER TABLE user_exercise_metric DROP COLUMN IF EXISTS ended_at;
+ALTER TABLE user_exercise_metric DROP COLUMN IF EXISTS started_at;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- Drinks logged through the day. drunk_at is the wall-clock time, without a time
+-- zone, and date the day it counts towards.
+CREATE TABLE IF NOT EXISTS user_hydration_metric (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    date DATE NOT NULL,
+    drunk_at TIMESTAMP(0) NOT NULL,
+    volume_ml INTEGER NOT NULL CHECK (volume_ml > 0),
+    beverage TEXT NOT NULL CHECK (beverage IN ('water', 'tea', 'coffee', 'alcohol')),
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS user_hydration_metric_user_id_date_idx ON user_hydration_metric (user_id, date);
+
+-- Glasses of water logged with food carry over as one entry a day, at noon, of
+-- 250 ml a glass.
+INSERT INTO user_hydration_metric (user_id, date, drunk_at, volume_ml, beverage)
+SELECT user_id, date, date + TIME '12:00', SUM(glass_no) * 250, 'water'
+FROM user_food_metric
+WHERE glass_no > 0
+GROUP BY user_id, date;
+
+-- +goose Down
+DROP TABLE IF EXISTS user_hydration_metric;
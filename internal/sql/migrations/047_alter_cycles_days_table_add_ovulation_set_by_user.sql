@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE cycles_days ADD COLUMN ovulation_set_by_user BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE cycles_days DROP COLUMN IF EXISTS ovulation_set_by_user;
@@ -0,0 +1,32 @@
+-- +goose Up
+-- A cycle ends when the next one starts, but cycles whose next period came early
+-- kept their days past it, leaving two days for the same date. The day of the later
+-- cycle is kept, taking over what was logged on the earlier one where nothing was
+-- logged on it, and the earlier cycle is shortened to end where the next begins.
+UPDATE cycles_days newer SET
+    flow = CASE WHEN newer.flow = 0 THEN older.flow ELSE newer.flow END,
+    pain = CASE WHEN newer.pain = 0 THEN older.pain ELSE newer.pain END,
+    tags = CASE WHEN cardinality(newer.tags) = 0 THEN older.tags ELSE newer.tags END,
+    cmq = CASE WHEN newer.cmq = '' THEN older.cmq ELSE newer.cmq END,
+    temperature = COALESCE(newer.temperature, older.temperature),
+    cervical_mucus = CASE WHEN newer.cervical_mucus = '' THEN older.cervical_mucus ELSE newer.cervical_mucus END
+FROM cycles_days older, menstrual_cycles older_cycle, menstrual_cycles newer_cycle
+WHERE older.user_id = newer.user_id AND older.date = newer.date
+AND older_cycle.id = older.cycle_id AND newer_cycle.id = newer.cycle_id
+AND newer_cycle.start_date > older_cycle.start_date;
+
+DELETE FROM cycles_days older
+USING cycles_days newer, menstrual_cycles older_cycle, menstrual_cycles newer_cycle
+WHERE older.user_id = newer.user_id AND older.date = newer.date
+AND older_cycle.id = older.cycle_id AND newer_cycle.id = newer.cycle_id
+AND newer_cycle.start_date > older_cycle.start_date;
+
+UPDATE menstrual_cycles mc SET cycle_length = n.next_start - mc.start_date
+FROM (
+    SELECT id, LEAD(start_date) OVER (PARTITION BY user_id ORDER BY start_date) AS next_start
+    FROM menstrual_cycles
+) n
+WHERE n.id = mc.id AND n.next_start < mc.start_date + mc.cycle_length;
+
+-- +goose Down
+-- The days removed can't be told apart from the ones kept, so nothing is restored.